@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dafiti-group/prow-plugins/pkg/teams"
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/git/v2"
+)
+
+const importTeamsCommand = "import-teams"
+
+type importOptions struct {
+	org    string
+	repo   string
+	dryRun bool
+	github prowflagutil.GitHubOptions
+}
+
+// importTeams runs `import-teams --org org --repo repo [team...]`, opening a
+// pull request that writes the org teams to the OWNERS_ALIASES of the repo
+func importTeams(args []string) {
+	o := importOptions{}
+	fs := flag.NewFlagSet(os.Args[0]+" "+importTeamsCommand, flag.ExitOnError)
+	fs.StringVar(&o.org, "org", "", "Org of the teams and of the repo.")
+	fs.StringVar(&o.repo, "repo", "", "Repo where OWNERS_ALIASES is written.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Dry run for testing. Uses API tokens but does not mutate.")
+	o.github.AddFlags(fs)
+	fs.Parse(args)
+
+	if o.org == "" || o.repo == "" {
+		logrus.Fatal("--org and --repo are required.")
+	}
+	if err := o.github.Validate(o.dryRun); err != nil {
+		logrus.Fatalf("Invalid options: %v", err)
+	}
+
+	secretAgent := &secret.Agent{}
+	if err := secretAgent.Start([]string{o.github.TokenPath}); err != nil {
+		logrus.WithError(err).Fatal("Error starting secrets agent.")
+	}
+
+	githubClient, err := o.github.GitHubClient(secretAgent, o.dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting GitHub client.")
+	}
+
+	gitClient, err := o.github.GitClient(secretAgent, o.dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting Git client.")
+	}
+
+	l := logrus.WithField("command", importTeamsCommand)
+	number, err := teams.ImportTeams(l, githubClient, git.ClientFactoryFrom(gitClient), o.org, o.repo, fs.Args())
+	// Fatal exits without running deferred calls
+	if err := gitClient.Clean(); err != nil {
+		l.WithError(err).Error("Error cleaning the git client.")
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("Error importing teams.")
+	}
+
+	if number == 0 {
+		fmt.Println("OWNERS_ALIASES already matches the GitHub teams")
+		return
+	}
+	fmt.Printf("Opened https://github.com/%v/%v/pull/%v\n", o.org, o.repo, number)
+}
@@ -19,28 +19,37 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/dafiti-group/prow-plugins/pkg/checkmarx"
-	"github.com/dafiti-group/prow-plugins/pkg/deploy"
-	"github.com/dafiti-group/prow-plugins/pkg/jira"
-	"github.com/dafiti-group/prow-plugins/pkg/teams"
+	_ "github.com/dafiti-group/prow-plugins/pkg/checkmarx"
+	_ "github.com/dafiti-group/prow-plugins/pkg/deploy"
+	_ "github.com/dafiti-group/prow-plugins/pkg/jira"
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
+	_ "github.com/dafiti-group/prow-plugins/pkg/teams"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/pkg/flagutil"
+	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/config/secret"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
 	"k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/interrupts"
+	"k8s.io/test-infra/prow/metrics"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/pluginhelp/externalplugins"
 	"k8s.io/test-infra/prow/plugins"
 	"k8s.io/test-infra/prow/repoowners"
 )
 
+// deployPlugin is the only plugin using the ProwJob client
+const deployPlugin = "deploy"
+
 type options struct {
 	port int
 
@@ -48,17 +57,88 @@ type options struct {
 	pluginConfig string
 	dryRun       bool
 	github       prowflagutil.GitHubOptions
+	kubernetes   prowflagutil.KubernetesOptions
+
+	plugins      string
+	excludeRepos prowflagutil.Strings
+	excluded     map[string]sets.String
+
+	workers       int
+	pluginWorkers prowflagutil.Strings
+	limits        map[string]int
+	queueSize     int
+	drainTimeout  time.Duration
+
+	eventStore   string
+	maxAttempts  int
+	retryBackoff time.Duration
+	adminPort    int
+
+	dedupeTTL   time.Duration
+	dedupeSize  int
+	metricsPort int
 
 	webhookSecretFile string
 }
 
 func (o *options) Validate() error {
-	for _, group := range []flagutil.OptionGroup{&o.github} {
+	groups := []flagutil.OptionGroup{&o.github}
+	// Only the deploy plugin creates prowjobs
+	if o.active(deployPlugin) {
+		groups = append(groups, &o.kubernetes)
+	}
+	for _, group := range groups {
 		if err := group.Validate(o.dryRun); err != nil {
 			return err
 		}
 	}
 
+	for _, name := range o.activePlugins() {
+		if _, found := plugin.Get(name); !found {
+			return fmt.Errorf("unknown plugin %q on --plugins", name)
+		}
+	}
+
+	o.excluded = map[string]sets.String{}
+	for _, exclusion := range o.excludeRepos.Strings() {
+		parts := strings.SplitN(exclusion, ":", 2)
+		if len(parts) != 2 || len(strings.Split(parts[1], "/")) != 2 {
+			return fmt.Errorf("--exclude-repo %q must be plugin:org/repo", exclusion)
+		}
+		if _, found := plugin.Get(parts[0]); !found {
+			return fmt.Errorf("unknown plugin %q on --exclude-repo", parts[0])
+		}
+		if o.excluded[parts[0]] == nil {
+			o.excluded[parts[0]] = sets.NewString()
+		}
+		o.excluded[parts[0]].Insert(strings.ToLower(parts[1]))
+	}
+
+	if o.workers < 1 || o.queueSize < 1 {
+		return fmt.Errorf("--workers and --queue-size must be positive")
+	}
+	if o.maxAttempts < 1 || o.retryBackoff <= 0 {
+		return fmt.Errorf("--max-attempts and --retry-backoff must be positive")
+	}
+	if o.dedupeTTL <= 0 || o.dedupeSize < 1 {
+		return fmt.Errorf("--dedupe-ttl and --dedupe-size must be positive")
+	}
+	o.limits = map[string]int{}
+	for _, limit := range o.pluginWorkers.Strings() {
+		parts := strings.SplitN(limit, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("--plugin-workers %q must be plugin=workers", limit)
+		}
+		if _, found := plugin.Get(parts[0]); !found {
+			return fmt.Errorf("unknown plugin %q on --plugin-workers", parts[0])
+		}
+		workers, err := strconv.Atoi(parts[1])
+		if err != nil || workers < 1 {
+			return fmt.Errorf("--plugin-workers %q must have a positive number of workers", limit)
+		}
+		o.limits[parts[0]] = workers
+	}
+
 	return nil
 }
 
@@ -70,14 +150,56 @@ func gatherOptions() options {
 	fs.StringVar(&o.pluginConfig, "plugin-config", "/etc/plugins/plugins.yaml", "Path to plugin config file.")
 	fs.BoolVar(&o.dryRun, "dry-run", false, "Dry run for testing. Uses API tokens but does not mutate.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file", "/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
-	for _, group := range []flagutil.OptionGroup{&o.github} {
+	fs.StringVar(&o.plugins, "plugins", strings.Join(plugin.Names(), ","), "Comma separated plugins to serve, on /hook and on their own path.")
+	fs.IntVar(&o.workers, "workers", 4, "Events each plugin handles at the same time.")
+	fs.Var(&o.pluginWorkers, "plugin-workers", "Workers of a single plugin, as plugin=workers. Can be passed multiple times.")
+	fs.IntVar(&o.queueSize, "queue-size", 100, "Events each plugin keeps waiting for a worker, events past it are refused.")
+	fs.DurationVar(&o.drainTimeout, "drain-timeout", 45*time.Second, "Time the events being handled get to finish on shutdown.")
+	fs.StringVar(&o.eventStore, "event-store", "", "Path to the bolt file keeping the events until they are handled, empty keeps them in memory.")
+	fs.IntVar(&o.maxAttempts, "max-attempts", 5, "Times an event is handled before it becomes a dead letter.")
+	fs.DurationVar(&o.retryBackoff, "retry-backoff", 10*time.Second, "Wait before the first retry of a failed event, doubled on every retry.")
+	fs.IntVar(&o.adminPort, "admin-port", 0, "Port serving the dead letter endpoints, 0 disables them.")
+	fs.DurationVar(&o.dedupeTTL, "dedupe-ttl", time.Hour, "Time a delivery id is remembered to skip its duplicates.")
+	fs.IntVar(&o.dedupeSize, "dedupe-size", 10000, "Delivery ids remembered at most, the oldest ones are forgotten first.")
+	fs.IntVar(&o.metricsPort, "metrics-port", 9090, "Port serving the prometheus metrics.")
+	fs.Var(&o.excludeRepos, "exclude-repo", "Repo a plugin skips even when plugins.yaml enables it on the org, as plugin:org/repo. Can be passed multiple times.")
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.kubernetes} {
 		group.AddFlags(fs)
 	}
+	// Every registered plugin adds its config flags, even when not active
+	for _, name := range plugin.Names() {
+		p, _ := plugin.Get(name)
+		p.AddFlags(fs)
+	}
 	fs.Parse(os.Args[1:])
 	return o
 }
 
+func (o *options) activePlugins() []string {
+	var names []string
+	for _, name := range strings.Split(o.plugins, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (o *options) active(name string) bool {
+	for _, n := range o.activePlugins() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == importTeamsCommand {
+		importTeams(os.Args[2:])
+		return
+	}
+
 	o := gatherOptions()
 	if err := o.Validate(); err != nil {
 		logrus.Fatalf("Invalid options: %v", err)
@@ -130,61 +252,97 @@ func main() {
 	ownersDirBlacklist := func() config.OwnersDirBlacklist {
 		return configAgent.Config().OwnersDirBlacklist
 	}
+	var prowJobClient prowv1.ProwJobInterface
+	if o.active(deployPlugin) {
+		if prowJobClient, err = o.kubernetes.ProwJobClient(configAgent.Config().ProwJobNamespace, o.dryRun); err != nil {
+			logrus.WithError(err).Fatal("Error getting ProwJob client.")
+		}
+	}
+
 	ownersClient := repoowners.NewClient(git.ClientFactoryFrom(gitClient), githubClient, mdYAMLEnabled, skipCollaborators, ownersDirBlacklist)
 
-	jiraServer := &jira.Server{
-		TokenGenerator: secretAgent.GetTokenGenerator(o.webhookSecretFile),
-		ConfigAgent:    configAgent,
-		Ghc:            githubClient,
-		Oc:             ownersClient,
-		Pa:             pluginAgent,
-		Log:            log.WithField("plugin", "jira"),
+	var active []plugin.Plugin
+	for _, name := range o.activePlugins() {
+		p, _ := plugin.Get(name)
+		err := p.Init(plugin.Agent{
+			Ghc:         githubClient,
+			Gc:          git.ClientFactoryFrom(gitClient),
+			Oc:          ownersClient,
+			Pa:          pluginAgent,
+			ConfigAgent: configAgent,
+			PJc:         prowJobClient,
+			Log:         log.WithField("plugin", name),
+		})
+		if err != nil {
+			logrus.WithError(err).Fatalf("Error starting the %v plugin.", name)
+		}
+		active = append(active, p)
 	}
 
-	teamsServer := &teams.Server{
-		TokenGenerator: secretAgent.GetTokenGenerator(o.webhookSecretFile),
-		ConfigAgent:    configAgent,
-		Gc:             git.ClientFactoryFrom(gitClient),
-		Ghc:            githubClient,
-		Oc:             ownersClient,
-		Log:            log.WithField("plugin", "teams"),
+	store, err := plugin.NewStore(o.eventStore)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error opening event store.")
 	}
 
-	checkmarxServer := &checkmarx.Server{
+	pool := &plugin.Pool{Workers: o.workers, Limits: o.limits, QueueSize: o.queueSize}
+	interrupts.OnInterrupt(func() {
+		// Handlers still running keep using the store, so it is only closed
+		// once they are done, bolt commits every write anyway
+		if left := pool.Drain(o.drainTimeout); left != 0 {
+			log.Warnf("Shutting down with %v events not handled, leaving the event store open.", left)
+			return
+		}
+		if err := store.Close(); err != nil {
+			log.WithError(err).Error("Error closing event store.")
+		}
+	})
+
+	// Every active plugin keeps its own path and gets the /hook events it is enabled for
+	mux := http.NewServeMux()
+	server := &plugin.Server{
 		TokenGenerator: secretAgent.GetTokenGenerator(o.webhookSecretFile),
-		ConfigAgent:    configAgent,
-		Gc:             git.ClientFactoryFrom(gitClient),
-		Ghc:            githubClient,
 		Pa:             pluginAgent,
-		Oc:             ownersClient,
-		Log:            log.WithField("plugin", "checkmarx"),
+		Plugins:        active,
+		Excluded:       o.excluded,
+		Pool:           pool,
+		Store:          store,
+		MaxAttempts:    o.maxAttempts,
+		Backoff:        o.retryBackoff,
+		Deliveries:     &plugin.Deliveries{TTL: o.dedupeTTL, Size: o.dedupeSize},
+		Log:            log.WithField("plugin", "hook"),
+	}
+	server.Serve(mux)
+	// Plugins start before the stored events are resumed, so their handlers
+	// find the state Start sets up
+	for _, p := range active {
+		p.Start(mux)
+	}
+	if err := server.Resume(); err != nil {
+		logrus.WithError(err).Fatal("Error resuming stored events.")
 	}
 
-	deployServer := &deploy.Server{
-		TokenGenerator: secretAgent.GetTokenGenerator(o.webhookSecretFile),
-		ConfigAgent:    configAgent,
-		Gc:             git.ClientFactoryFrom(gitClient),
-		Ghc:            githubClient,
-		Pa:             pluginAgent,
-		Oc:             ownersClient,
-		Log:            log.WithField("plugin", "deploy"),
+	helpProvider := func(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
+		pluginHelp := &pluginhelp.PluginHelp{
+			Description: `This is a collection of dafiti plugins`,
+		}
+		for _, p := range active {
+			help := p.Help()
+			pluginHelp.Description += fmt.Sprintf("\n\n%v: %v", p.Name(), help.Description)
+			for _, command := range help.Commands {
+				pluginHelp.AddCommand(command)
+			}
+		}
+		return pluginHelp, nil
 	}
 
-	mux := http.NewServeMux()
-	// mux.Handle("/jira-checker", jiraServer)
-	// mux.Handle("/teams-sync", teamsServer)
-	// mux.Handle("/checkmarx", checkmarxServer)
-	mux.Handle("/deploy", deployServer)
-	externalplugins.ServeExternalPluginHelp(mux, log, HelpProvider)
+	externalplugins.ServeExternalPluginHelp(mux, log, helpProvider)
 	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux}
 	defer interrupts.WaitForGracefulShutdown()
-	interrupts.ListenAndServe(httpServer, 5*time.Second)
-}
-
-func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
-	pluginHelp := &pluginhelp.PluginHelp{
-		Description: `This is a collection of dafiti plugins`,
+	metrics.ExposeMetrics("prow-plugins", configAgent.Config().PushGateway, o.metricsPort)
+	if o.adminPort != 0 {
+		adminMux := http.NewServeMux()
+		server.ServeAdmin(adminMux)
+		interrupts.ListenAndServe(&http.Server{Addr: ":" + strconv.Itoa(o.adminPort), Handler: adminMux}, 5*time.Second)
 	}
-	pluginHelp.AddCommand(teams.HelpProvider())
-	return pluginHelp, nil
+	interrupts.ListenAndServe(httpServer, 5*time.Second)
 }
@@ -5,8 +5,11 @@ go 1.14
 require (
 	github.com/creasty/defaults v1.4.0
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
-	github.com/k0kubun/pp v3.0.1+incompatible
+	github.com/prometheus/client_golang v1.5.0
+	github.com/shurcooL/githubv4 v0.0.0-20191102174205-af46314aec7b
 	github.com/sirupsen/logrus v1.6.0
+	go.etcd.io/bbolt v1.3.5
+	gopkg.in/robfig/cron.v2 v2.0.0-20150107220207-be2e0b0deed5
 	gopkg.in/yaml.v1 v1.0.0-20140924161607-9f9df34309c0
 	gopkg.in/yaml.v2 v2.2.8
 	k8s.io/apimachinery v0.17.3
@@ -14,31 +14,21 @@ limitations under the License.
 package checkmarx
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
+	"flag"
 	"net/http"
 	"regexp"
 	"strings"
 
 	"github.com/sirupsen/logrus"
 
-	"k8s.io/test-infra/prow/config"
-	"k8s.io/test-infra/prow/git/v2"
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pluginhelp"
-	"k8s.io/test-infra/prow/plugins"
-	"k8s.io/test-infra/prow/repoowners"
 )
 
 type Server struct {
-	Oc             *repoowners.Client
-	Pa             *plugins.ConfigAgent
-	TokenGenerator func() []byte
-	ConfigAgent    *config.Agent
-	Gc             git.ClientFactory
-	Ghc            github.Client
-	Log            *logrus.Entry
+	Ghc github.Client
+	Log *logrus.Entry
 }
 
 const (
@@ -49,51 +39,45 @@ var (
 	titleRegex = regexp.MustCompile(`[A-Z]{1,}-\d+`)
 )
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, s.TokenGenerator)
-	if !ok {
-		s.Log.Error("validate webhook failed")
-		return
-	}
+func init() {
+	plugin.Register(&Server{})
+}
 
-	// Respond with
-	if err := s.handleEvent(eventType, eventGUID, payload); err != nil {
-		s.Log.WithError(err).Error("Error parsing event.")
-		fmt.Fprint(w, "Something went wrong")
-		return
-	}
+// Name is the name of the plugin on plugins.yaml
+func (s *Server) Name() string {
+	return "checkmarx"
+}
 
-	s.Log.Info("handle event ok")
-	fmt.Fprint(w, "Event received. Have a nice day.")
+// Path is the legacy endpoint of the plugin
+func (s *Server) Path() string {
+	return "/checkmarx"
 }
 
-func (s *Server) handleEvent(eventType, eventGUID string, payload []byte) (err error) {
-	l := s.Log.WithFields(
-		logrus.Fields{
-			"event-type":     eventType,
-			github.EventGUID: eventGUID,
-		},
-	)
+// AddFlags registers no flags, the plugin has no config
+func (s *Server) AddFlags(_ *flag.FlagSet) {}
 
-	switch eventType {
-	case "pull_request":
-		var p github.PullRequestEvent
-
-		if err := json.Unmarshal(payload, &p); err != nil {
-			return err
-		}
-
-		go func() {
-			if err := s.handlePR(l, &p); err != nil {
-				s.Log.WithError(err).WithFields(l.Data).Info("Refreshing github statuses failed.")
-			}
-		}()
-	default:
-		s.Log.Debugf("skipping event of type %q", eventType)
-	}
+// Init takes the shared clients
+func (s *Server) Init(a plugin.Agent) error {
+	s.Ghc = a.Ghc
+	s.Log = a.Log
 	return nil
 }
 
+// Handlers are the typed event handlers of the plugin
+func (s *Server) Handlers() plugin.Handlers {
+	return plugin.Handlers{PullRequest: s.handlePR}
+}
+
+// Help describes the plugin, it has no commands
+func (s *Server) Help() *pluginhelp.PluginHelp {
+	return &pluginhelp.PluginHelp{
+		Description: "The checkmarx plugin labels open pull requests with " + InvalidLabel + " until their Checkmarx scan is verified",
+	}
+}
+
+// Start has no background work
+func (s *Server) Start(_ *http.ServeMux) {}
+
 func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err error) {
 	var (
 		org    = p.Repo.Owner.Login
@@ -107,13 +91,13 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 	botName, err := s.Ghc.BotName()
 	if err != nil {
 		l.WithError(err).Error("failed getting botName")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	// Clear comments
 	if err = s.Ghc.DeleteStaleComments(org, repo, number, nil, shouldPrune(botName)); err != nil {
 		l.WithError(err).Error("failed to prune comments")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	// Setup Logger
@@ -132,40 +116,12 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 		return nil
 	}
 
-	pluginAgent := s.Pa
-	if pluginAgent == nil {
-		return errors.New("Could not get Plugin Agent in checkmarx")
-	}
-
-	config := pluginAgent.Config()
-	if config == nil {
-		return errors.New("Could not get Configuration in checkmarx")
-	}
-
-	if orgs, repos := config.EnabledReposForExternalPlugin("checkmarx"); orgs != nil || repos != nil {
-		found := false
-		repoOrg := fmt.Sprintf("%v/%v", org, repo)
-		for _, v := range repos {
-			if v == repoOrg {
-				found = true
-			}
-		}
-
-		if found {
-			l.Infof("%v is elegible", repoOrg)
-		} else {
-			err = fmt.Errorf("Org Repo '%v' not allowed", repoOrg)
-			l.Error(err)
-			return err
-		}
-	}
-
 	err = s.Ghc.AddLabel(org, repo, number, InvalidLabel)
 	if err != nil {
 		l.WithError(err).Error("failed to add label")
-		return err
+		return plugin.Retryable(err)
 	}
-	l.Info("Label added %v", InvalidLabel)
+	l.Infof("Label added %v", InvalidLabel)
 
 	// @TODO: Start checkmarx job
 	l.Info("Start prow job")
@@ -187,13 +143,6 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 	return nil
 }
 
-//
-func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
-	return &pluginhelp.PluginHelp{
-		Description: "The Jira checker plugin checks your PR name",
-	}, nil
-}
-
 //
 func shouldPrune(botName string) func(github.IssueComment) bool {
 	return func(ic github.IssueComment) bool {
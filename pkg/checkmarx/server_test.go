@@ -0,0 +1,91 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkmarx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
+	"k8s.io/test-infra/prow/github"
+)
+
+// errServer is what the client returns when GitHub answers with a 5xx
+var errServer = errors.New("status code 502 not one of [200], body: Bad Gateway")
+
+// fakeGithub fails the call named by failing
+type fakeGithub struct {
+	github.Client
+	failing string
+}
+
+func (f *fakeGithub) fail(call string) error {
+	if f.failing == call {
+		return errServer
+	}
+	return nil
+}
+
+func (f *fakeGithub) BotName() (string, error) {
+	return "bot", f.fail("BotName")
+}
+
+func (f *fakeGithub) DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error {
+	return f.fail("DeleteStaleComments")
+}
+
+func (f *fakeGithub) AddLabel(org, repo string, number int, label string) error {
+	return f.fail("AddLabel")
+}
+
+func TestHandlePRRetriesServerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing string
+	}{
+		{
+			name:    "bot name",
+			failing: "BotName",
+		},
+		{
+			name:    "stale comments",
+			failing: "DeleteStaleComments",
+		},
+		{
+			name:    "add label",
+			failing: "AddLabel",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{Ghc: &fakeGithub{failing: tc.failing}}
+			event := &github.PullRequestEvent{
+				Action: github.PullRequestActionOpened,
+				Number: 1,
+				Repo:   github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+
+			err := s.handlePR(logrus.NewEntry(logrus.New()), event)
+			if !errors.Is(err, errServer) {
+				t.Fatalf("expected %v, got %v", errServer, err)
+			}
+			if !plugin.IsRetryable(err) {
+				t.Errorf("expected %v to be retried", err)
+			}
+		})
+	}
+}
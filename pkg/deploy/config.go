@@ -0,0 +1,142 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the deploy plugin configuration, usually mounted from a ConfigMap
+type Config struct {
+	Repos []RepoConfig `yaml:"repos"`
+}
+
+// RepoConfig declares the environments of an org or of a single org/repo
+type RepoConfig struct {
+	// Repo is either "org" or "org/repo"
+	Repo         string        `yaml:"repo"`
+	Environments []Environment `yaml:"environments"`
+	// ReleaseManagers is the OWNERS_ALIASES alias allowed to deploy during a freeze
+	ReleaseManagers string `yaml:"releaseManagers"`
+	// GitOps are the manifests repos bumped when a pull request is merged
+	GitOps []GitOps `yaml:"gitops"`
+}
+
+// Environment maps an environment name to the postsubmit job that deploys it
+type Environment struct {
+	Name    string        `yaml:"name"`
+	Job     string        `yaml:"job"`
+	Timeout time.Duration `default:"1h" yaml:"timeout"`
+	Freezes []Freeze      `yaml:"freezes"`
+	// PromoteFrom is the only environment that can be promoted to this one
+	PromoteFrom string `yaml:"promoteFrom"`
+	// Soak is how long a deploy must run here before being promoted
+	Soak time.Duration `yaml:"soak"`
+}
+
+// LoadConfig reads the deploy configuration from path
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{}
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	if err = defaults.Set(c); err != nil {
+		return nil, err
+	}
+
+	return c, c.validate()
+}
+
+func (c *Config) validate() error {
+	for _, r := range c.Repos {
+		if r.Repo == "" {
+			return fmt.Errorf("deploy config: repo can't be empty")
+		}
+		for i := range r.GitOps {
+			if err := r.GitOps[i].validate(); err != nil {
+				return fmt.Errorf("deploy config: %v: %v", r.Repo, err)
+			}
+		}
+		for _, e := range r.Environments {
+			if e.Name == "" || e.Job == "" {
+				return fmt.Errorf("deploy config: %v has an environment without name or job", r.Repo)
+			}
+			if e.PromoteFrom != "" && !r.hasEnvironment(e.PromoteFrom) {
+				return fmt.Errorf("deploy config: %v %v is promoted from unknown environment %v", r.Repo, e.Name, e.PromoteFrom)
+			}
+			for i := range e.Freezes {
+				if err := e.Freezes[i].validate(); err != nil {
+					return fmt.Errorf("deploy config: %v %v: %v", r.Repo, e.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RepoConfigFor returns the repo level config, falling back to the org one
+func (c *Config) RepoConfigFor(org, repo string) *RepoConfig {
+	fullName := fmt.Sprintf("%v/%v", org, repo)
+
+	var orgConfig *RepoConfig
+	for i, r := range c.Repos {
+		if strings.EqualFold(r.Repo, fullName) {
+			return &c.Repos[i]
+		}
+		if strings.EqualFold(r.Repo, org) {
+			orgConfig = &c.Repos[i]
+		}
+	}
+	return orgConfig
+}
+
+func (r *RepoConfig) hasEnvironment(name string) bool {
+	for _, e := range r.Environments {
+		if strings.EqualFold(e.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Environment returns the named environment configured for org/repo
+func (c *Config) Environment(org, repo, name string) (*Environment, error) {
+	rc := c.RepoConfigFor(org, repo)
+	if rc == nil {
+		return nil, fmt.Errorf("no environments configured for %v/%v", org, repo)
+	}
+
+	for i, e := range rc.Environments {
+		if strings.EqualFold(e.Name, name) {
+			return &rc.Environments[i], nil
+		}
+	}
+	return nil, fmt.Errorf("environment `%v` is not configured for %v/%v", name, org, repo)
+}
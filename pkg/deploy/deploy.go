@@ -0,0 +1,303 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/pjutil"
+)
+
+const (
+	// EnvironmentLabel is set on every deploy prow job
+	EnvironmentLabel = "prow-plugins.dafiti.com/environment"
+
+	pollInterval = 30 * time.Second
+)
+
+var (
+	deployRe   = regexp.MustCompile(`(?mi)^/deploy\s+(\S+)(\s+--force-freeze)?\s*$`)
+	rollbackRe = regexp.MustCompile(`(?mi)^/rollback\s+(\S+)(?:\s+to\s+([0-9a-f]{7,40}))?\s*$`)
+
+	notMemberMsg       = "@%v only members of %v can deploy"
+	deployStartedMsg   = "Deploying `%v` to **%v** with job `%v`"
+	deployFailedMsg    = "Deploy of `%v` to **%v** could not start: `%v`\n<!-- %v -->"
+	deployFinishedMsg  = "Deploy of `%v` to **%v** finished: **%v**"
+	deployTimeoutMsg   = "Deploy of `%v` to **%v** did not finish after %v, marking it as failed"
+	rollbackStartedMsg = "Rolling back **%v** to `%v`, deployed by @%v from #%v"
+	noRollbackMsg      = "There is no successful deploy of **%v** to roll back to"
+	unknownShaMsg      = "`%v` was never successfully deployed to **%v**"
+)
+
+func (s *Server) handleComment(l *logrus.Entry, e *github.IssueCommentEvent) (err error) {
+	var (
+		org    = e.Repo.Owner.Login
+		repo   = e.Repo.Name
+		number = e.Issue.Number
+		body   = e.Comment.Body
+		user   = e.Comment.User.Login
+	)
+
+	if e.Action != github.IssueCommentActionCreated || !e.Issue.IsPullRequest() {
+		return nil
+	}
+
+	deployMatch := deployRe.FindStringSubmatch(body)
+	rollbackMatch := rollbackRe.FindStringSubmatch(body)
+	promoteMatch := promoteRe.FindStringSubmatch(body)
+	if deployMatch == nil && rollbackMatch == nil && promoteMatch == nil {
+		return nil
+	}
+
+	// Setup Logger
+	l = l.WithFields(logrus.Fields{
+		github.OrgLogField:  org,
+		github.RepoLogField: repo,
+		github.PrLogField:   number,
+		"user":              user,
+	})
+
+	// Only org members can deploy
+	member, err := s.Ghc.IsMember(org, user)
+	if err != nil {
+		l.WithError(err).Error("failed to check org membership")
+		return plugin.Retryable(err)
+	}
+	if !member {
+		return s.notice(org, repo, number, fmt.Sprintf(notMemberMsg, user, org))
+	}
+
+	switch {
+	case deployMatch != nil:
+		return s.handleDeploy(l, org, repo, number, user, deployMatch[1], deployMatch[2] != "")
+	case promoteMatch != nil:
+		return s.handlePromote(l, org, repo, number, user, promoteMatch[1], promoteMatch[2], promoteMatch[3] != "")
+	default:
+		return s.handleRollback(l, org, repo, number, user, rollbackMatch[1], rollbackMatch[2])
+	}
+}
+
+func (s *Server) handleDeploy(l *logrus.Entry, org, repo string, number int, user, envName string, force bool) (err error) {
+	env, err := s.Config.Environment(org, repo, envName)
+	if err != nil {
+		return s.notice(org, repo, number, err.Error())
+	}
+
+	pr, err := s.Ghc.GetPullRequest(org, repo, number)
+	if err != nil {
+		l.WithError(err).Error("failed to get pull request")
+		return err
+	}
+
+	r := Record{
+		Org:         org,
+		Repo:        repo,
+		Environment: env.Name,
+		Ref:         pr.Head.Ref,
+		SHA:         pr.Head.SHA,
+		PR:          number,
+		Author:      user,
+		Job:         env.Job,
+	}
+
+	// Refuse during a freeze unless a release manager forces it
+	if ok, err := s.checkFreeze(l, &r, env, pr.Base.Ref, force); !ok {
+		return err
+	}
+
+	return s.startDeploy(l, r, env.Timeout)
+}
+
+func (s *Server) handleRollback(l *logrus.Entry, org, repo string, number int, user, envName, sha string) (err error) {
+	env, err := s.Config.Environment(org, repo, envName)
+	if err != nil {
+		return s.notice(org, repo, number, err.Error())
+	}
+
+	// Without a target we go back to the deploy before the current one
+	var target *Record
+	if sha == "" {
+		target = s.History.PreviousSuccess(org, repo, env.Name)
+		if target == nil {
+			return s.notice(org, repo, number, fmt.Sprintf(noRollbackMsg, env.Name))
+		}
+	} else {
+		target = s.History.Find(org, repo, env.Name, sha)
+		if target == nil {
+			return s.notice(org, repo, number, fmt.Sprintf(unknownShaMsg, sha, env.Name))
+		}
+	}
+
+	msg := fmt.Sprintf(rollbackStartedMsg, env.Name, target.SHA, target.Author, target.PR)
+	if err = s.Ghc.CreateComment(org, repo, number, msg); err != nil {
+		return err
+	}
+
+	return s.startDeploy(l, Record{
+		Org:         org,
+		Repo:        repo,
+		Environment: env.Name,
+		Ref:         target.Ref,
+		SHA:         target.SHA,
+		PR:          number,
+		Author:      user,
+		Job:         env.Job,
+		Rollback:    true,
+	}, env.Timeout)
+}
+
+// startDeploy queues the deploy, it runs as soon as its environment is idle
+func (s *Server) startDeploy(l *logrus.Entry, r Record, timeout time.Duration) error {
+	if _, err := s.postsubmit(r.Org, r.Repo, r.Job); err != nil {
+		return s.notice(r.Org, r.Repo, r.PR, err.Error())
+	}
+
+	return s.enqueue(&queuedDeploy{
+		log:     l,
+		record:  r,
+		timeout: timeout,
+	})
+}
+
+// runDeploy creates the deploy prow job, records it and watches it until it
+// finishes, if it can't be started the failure is reported on the queue
+// comment and the environment is released
+func (s *Server) runDeploy(d *queuedDeploy) (err error) {
+	var (
+		r = d.record
+		l = d.log
+	)
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		msg := fmt.Sprintf(deployFailedMsg, r.SHA, r.Environment, err, d.marker())
+		if err := s.editQueueComment(d, msg); err != nil {
+			l.WithError(err).Warn("failed to comment deploy failure")
+		}
+		s.next(r)
+	}()
+
+	job, err := s.postsubmit(r.Org, r.Repo, r.Job)
+	if err != nil {
+		return err
+	}
+
+	refs := prowapi.Refs{
+		Org:     r.Org,
+		Repo:    r.Repo,
+		BaseRef: r.Ref,
+		BaseSHA: r.SHA,
+	}
+	labels := map[string]string{EnvironmentLabel: r.Environment}
+	pj := pjutil.NewProwJob(pjutil.PostsubmitSpec(*job, refs), labels, nil)
+
+	l = l.WithFields(pjutil.ProwJobFields(&pj))
+	if _, err = s.PJc.Create(&pj); err != nil {
+		l.WithError(err).Error("failed to create deploy prow job")
+		return err
+	}
+
+	r.ID = pj.Name
+	r.Outcome = OutcomePending
+	r.StartedAt = time.Now()
+	if err = s.History.Add(r); err != nil {
+		l.WithError(err).Error("failed to record deploy")
+		return err
+	}
+
+	go s.watch(l, r, d.timeout)
+
+	msg := fmt.Sprintf(deployStartedMsg, r.SHA, r.Environment, r.Job)
+	if err := s.Ghc.CreateComment(r.Org, r.Repo, r.PR, msg); err != nil {
+		l.WithError(err).Warn("failed to comment deploy start")
+	}
+	return nil
+}
+
+// watch polls the deploy prow job, records its outcome and releases the environment
+func (s *Server) watch(l *logrus.Entry, r Record, timeout time.Duration) {
+	defer s.next(r)
+
+	deadline := r.StartedAt.Add(timeout)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pj, err := s.PJc.Get(r.ID, metav1.GetOptions{})
+		if err != nil {
+			l.WithError(err).Warn("failed to get deploy prow job")
+		}
+
+		var msg string
+		outcome := OutcomeFailure
+		switch {
+		case err == nil && pj.Complete():
+			if pj.Status.State == prowapi.SuccessState {
+				outcome = OutcomeSuccess
+			}
+			msg = fmt.Sprintf(deployFinishedMsg, r.SHA, r.Environment, pj.Status.State)
+		case time.Now().After(deadline):
+			msg = fmt.Sprintf(deployTimeoutMsg, r.SHA, r.Environment, timeout)
+		default:
+			continue
+		}
+
+		if err = s.History.SetOutcome(r.ID, outcome); err != nil {
+			l.WithError(err).Error("failed to record deploy outcome")
+		}
+		if err = s.Ghc.CreateComment(r.Org, r.Repo, r.PR, msg); err != nil {
+			l.WithError(err).Error("failed to comment deploy outcome")
+		}
+		return
+	}
+}
+
+// Resume watches the deploys that were still pending when the plugin stopped
+func (s *Server) Resume() {
+	for _, r := range s.History.List("", "", "") {
+		if r.Outcome != OutcomePending {
+			continue
+		}
+
+		timeout := time.Hour
+		if env, err := s.Config.Environment(r.Org, r.Repo, r.Environment); err == nil {
+			timeout = env.Timeout
+		}
+
+		// The running deploy holds its environment so new ones wait for it
+		l := s.Log.WithField("deploy", r.ID)
+		s.Queue.Push(&queuedDeploy{log: l, record: r, timeout: timeout})
+		go s.watch(l, r, timeout)
+	}
+}
+
+func (s *Server) postsubmit(org, repo, name string) (*config.Postsubmit, error) {
+	for _, p := range s.ConfigAgent.Config().AllStaticPostsubmits([]string{fmt.Sprintf("%v/%v", org, repo)}) {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("postsubmit job `%v` not found for %v/%v", name, org, repo)
+}
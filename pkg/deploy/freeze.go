@@ -0,0 +1,120 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/robfig/cron.v2"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	frozenMsg          = "**%v** is frozen: %v\nA release manager can still deploy with `/deploy %v --force-freeze`"
+	forceNotAllowedMsg = "@%v only the release managers (`%v`) can deploy during a freeze"
+)
+
+// Freeze is a window where deploys to an environment are refused. It is
+// either recurring, starting on every Cron activation and lasting Duration,
+// or fixed, going From a date To another
+type Freeze struct {
+	Message  string        `yaml:"message"`
+	Cron     string        `yaml:"cron"`
+	Duration time.Duration `yaml:"duration"`
+	From     time.Time     `yaml:"from"`
+	To       time.Time     `yaml:"to"`
+
+	schedule cron.Schedule
+}
+
+func (f *Freeze) validate() (err error) {
+	switch {
+	case f.Cron != "":
+		if f.Duration <= 0 {
+			return fmt.Errorf("freeze %q needs a duration", f.Cron)
+		}
+		if f.schedule, err = cron.Parse(f.Cron); err != nil {
+			return fmt.Errorf("freeze %q: %v", f.Cron, err)
+		}
+	case f.From.IsZero() || f.To.IsZero():
+		return fmt.Errorf("freeze %q needs either a cron or a from and to date", f.Message)
+	case !f.From.Before(f.To):
+		return fmt.Errorf("freeze %q ends before it starts", f.Message)
+	}
+	return nil
+}
+
+// Active tells if t is inside the freeze window
+func (f *Freeze) Active(t time.Time) bool {
+	if f.schedule != nil {
+		// The window is open if it started less than Duration ago
+		return !f.schedule.Next(t.Add(-f.Duration)).After(t)
+	}
+	return !t.Before(f.From) && t.Before(f.To)
+}
+
+// ActiveFreeze returns the freeze the environment is in at t, if any
+func (e *Environment) ActiveFreeze(t time.Time) *Freeze {
+	for i := range e.Freezes {
+		if e.Freezes[i].Active(t) {
+			return &e.Freezes[i]
+		}
+	}
+	return nil
+}
+
+// isReleaseManager tells if user belongs to the release managers alias of org/repo
+func (s *Server) isReleaseManager(org, repo, base, user string) (bool, error) {
+	rc := s.Config.RepoConfigFor(org, repo)
+	if rc == nil || rc.ReleaseManagers == "" {
+		return false, nil
+	}
+
+	aliases, err := s.Oc.LoadRepoAliases(org, repo, base)
+	if err != nil {
+		return false, err
+	}
+	return aliases.ExpandAlias(rc.ReleaseManagers).Has(github.NormLogin(user)), nil
+}
+
+// checkFreeze comments and returns false when the deploy must be refused
+func (s *Server) checkFreeze(l *logrus.Entry, r *Record, env *Environment, base string, force bool) (bool, error) {
+	freeze := env.ActiveFreeze(time.Now())
+	if freeze == nil {
+		return true, nil
+	}
+
+	if !force {
+		msg := fmt.Sprintf(frozenMsg, env.Name, freeze.Message, env.Name)
+		return false, s.notice(r.Org, r.Repo, r.PR, msg)
+	}
+
+	allowed, err := s.isReleaseManager(r.Org, r.Repo, base, r.Author)
+	if err != nil {
+		l.WithError(err).Error("failed to load release managers")
+		return false, err
+	}
+	if !allowed {
+		alias := s.Config.RepoConfigFor(r.Org, r.Repo).ReleaseManagers
+		msg := fmt.Sprintf(forceNotAllowedMsg, r.Author, alias)
+		return false, s.notice(r.Org, r.Repo, r.PR, msg)
+	}
+
+	l.WithField("freeze", freeze.Message).Warn("freeze forced by release manager")
+	r.ForcedFreeze = freeze.Message
+	return true, nil
+}
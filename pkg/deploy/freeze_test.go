@@ -0,0 +1,165 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreezeActive(t *testing.T) {
+	// 2020-06-01 is a Monday
+	monday := func(hour, min int) time.Time {
+		return time.Date(2020, 6, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		freeze Freeze
+		at     time.Time
+		active bool
+	}{
+		{
+			name:   "five fields, inside the window",
+			freeze: Freeze{Cron: "TZ=UTC 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(10, 30),
+			active: true,
+		},
+		{
+			name:   "five fields, on the activation",
+			freeze: Freeze{Cron: "TZ=UTC 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(9, 0),
+			active: true,
+		},
+		{
+			name:   "five fields, before the activation",
+			freeze: Freeze{Cron: "TZ=UTC 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(8, 59),
+		},
+		{
+			name:   "five fields, once the window ended",
+			freeze: Freeze{Cron: "TZ=UTC 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(11, 0),
+		},
+		{
+			name:   "six fields start with the seconds",
+			freeze: Freeze{Cron: "TZ=UTC 0 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(10, 30),
+			active: true,
+		},
+		{
+			name:   "six fields, another day",
+			freeze: Freeze{Cron: "TZ=UTC 0 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(10, 30).Add(24 * time.Hour),
+		},
+		{
+			name:   "timezone moves the window",
+			freeze: Freeze{Cron: "TZ=America/Sao_Paulo 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(12, 30),
+			active: true,
+		},
+		{
+			name:   "timezone, utc hours are outside the window",
+			freeze: Freeze{Cron: "TZ=America/Sao_Paulo 0 9 * * 1", Duration: 2 * time.Hour},
+			at:     monday(10, 30),
+		},
+		{
+			name:   "window spanning midnight",
+			freeze: Freeze{Cron: "TZ=UTC 0 22 * * 0", Duration: 4 * time.Hour},
+			at:     monday(1, 0),
+			active: true,
+		},
+		{
+			name:   "fixed dates, inside",
+			freeze: Freeze{From: monday(0, 0), To: monday(12, 0)},
+			at:     monday(6, 0),
+			active: true,
+		},
+		{
+			name:   "fixed dates, on the start",
+			freeze: Freeze{From: monday(0, 0), To: monday(12, 0)},
+			at:     monday(0, 0),
+			active: true,
+		},
+		{
+			name:   "fixed dates, on the end",
+			freeze: Freeze{From: monday(0, 0), To: monday(12, 0)},
+			at:     monday(12, 0),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := tc.freeze
+			if err := f.validate(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if active := f.Active(tc.at); active != tc.active {
+				t.Errorf("expected active %v at %v, got %v", tc.active, tc.at, active)
+			}
+		})
+	}
+}
+
+func TestFreezeValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		freeze  Freeze
+		wantErr bool
+	}{
+		{
+			name:   "cron with duration",
+			freeze: Freeze{Cron: "0 9 * * 1", Duration: time.Hour},
+		},
+		{
+			name:    "cron without duration",
+			freeze:  Freeze{Cron: "0 9 * * 1"},
+			wantErr: true,
+		},
+		{
+			name:    "cron with four fields",
+			freeze:  Freeze{Cron: "9 * * 1", Duration: time.Hour},
+			wantErr: true,
+		},
+		{
+			name:    "unknown timezone",
+			freeze:  Freeze{Cron: "TZ=Nowhere/City 0 9 * * 1", Duration: time.Hour},
+			wantErr: true,
+		},
+		{
+			name:   "fixed dates",
+			freeze: Freeze{From: now, To: now.Add(time.Hour)},
+		},
+		{
+			name:    "missing end",
+			freeze:  Freeze{From: now},
+			wantErr: true,
+		},
+		{
+			name:    "ends before it starts",
+			freeze:  Freeze{From: now, To: now.Add(-time.Hour)},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.freeze.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	FormatKustomize = "kustomize"
+	FormatHelm      = "helm"
+)
+
+var (
+	bumpTitle      = "Bump %v to %v"
+	bumpBody       = "Bumps `%v` to `%v` on `%v`.\n\nSource: %v/%v#%v"
+	bumpOpenedMsg  = "Opened %v#%v to bump `%v` to `%v`"
+	bumpFailedMsg  = "Failed to bump `%v` on %v: `%v`"
+	bumpBranchName = "prow-plugins/bump-%v-%v"
+)
+
+// GitOps is a manifests repo where the image of the repo is bumped on merge
+type GitOps struct {
+	// Repo is the org/repo of the manifests
+	Repo   string `yaml:"repo"`
+	Branch string `default:"master" yaml:"branch"`
+	// Path is the kustomization or helm values file inside Repo
+	Path   string `yaml:"path"`
+	Image  string `yaml:"image"`
+	Format string `default:"kustomize" yaml:"format"`
+	// ShortSHA tags the image with the 7 first characters of the merge commit
+	ShortSHA bool `yaml:"shortSha"`
+}
+
+func (g *GitOps) validate() error {
+	if len(strings.Split(g.Repo, "/")) != 2 {
+		return fmt.Errorf("gitops repo %q must be org/repo", g.Repo)
+	}
+	if g.Path == "" || g.Image == "" {
+		return fmt.Errorf("gitops %v needs a path and an image", g.Repo)
+	}
+	if g.Format != FormatKustomize && g.Format != FormatHelm {
+		return fmt.Errorf("gitops %v format must be %v or %v", g.Repo, FormatKustomize, FormatHelm)
+	}
+	return nil
+}
+
+// handleMerged opens a bump pull request on every gitops repo of the merged repo
+func (s *Server) handleMerged(l *logrus.Entry, p *github.PullRequestEvent) error {
+	var (
+		org    = p.Repo.Owner.Login
+		repo   = p.Repo.Name
+		number = p.Number
+		pr     = p.PullRequest
+	)
+
+	rc := s.Config.RepoConfigFor(org, repo)
+	if rc == nil || len(rc.GitOps) == 0 {
+		return nil
+	}
+
+	// Only merges to the default branch are released
+	if pr.Base.Ref != pr.Base.Repo.DefaultBranch || pr.MergeSHA == nil {
+		l.Infof("merge to %v is not released", pr.Base.Ref)
+		return nil
+	}
+
+	var errs []string
+	for _, g := range rc.GitOps {
+		tag := *pr.MergeSHA
+		if g.ShortSHA && len(tag) > 7 {
+			tag = tag[:7]
+		}
+
+		bumpNumber, err := s.bumpImage(l.WithField("gitops", g.Repo), org, repo, number, g, tag)
+		if err != nil {
+			errs = append(errs, err.Error())
+			if err = s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(bumpFailedMsg, g.Image, g.Repo, err)); err != nil {
+				l.WithError(err).Error("failed to comment")
+			}
+			continue
+		}
+		if bumpNumber == 0 {
+			continue
+		}
+
+		msg := fmt.Sprintf(bumpOpenedMsg, g.Repo, bumpNumber, g.Image, tag)
+		if err = s.Ghc.CreateComment(org, repo, number, msg); err != nil {
+			l.WithError(err).Error("failed to comment")
+		}
+	}
+
+	// The failures are on the comments, bumping again could open duplicates
+	if len(errs) != 0 {
+		l.Errorf("failed to bump images: %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// bumpImage updates the image tag on the gitops repo and opens a pull request,
+// it returns 0 when the tag is already there
+func (s *Server) bumpImage(l *logrus.Entry, org, repo string, number int, g GitOps, tag string) (int, error) {
+	parts := strings.Split(g.Repo, "/")
+	gOrg, gRepo := parts[0], parts[1]
+
+	c, err := s.Gc.ClientFor(gOrg, gRepo)
+	if err != nil {
+		l.WithError(err).Error("failed to clone gitops repo")
+		return 0, err
+	}
+	defer func() {
+		if err := c.Clean(); err != nil {
+			l.WithError(err).Error("failed to clean gitops repo")
+		}
+	}()
+
+	if err = c.Checkout(g.Branch); err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(c.Directory(), g.Path)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, changed, err := bumpTag(content, g.Format, g.Image, tag)
+	if err != nil {
+		return 0, err
+	}
+	if !changed {
+		l.Infof("%v is already on %v", g.Image, tag)
+		return 0, nil
+	}
+
+	branch := fmt.Sprintf(bumpBranchName, repo, tag)
+	if err = c.CheckoutNewBranch(branch); err != nil {
+		return 0, err
+	}
+	if err = ioutil.WriteFile(path, updated, 0644); err != nil {
+		return 0, err
+	}
+
+	title := fmt.Sprintf(bumpTitle, g.Image, tag)
+	body := fmt.Sprintf(bumpBody, g.Image, tag, g.Path, org, repo, number)
+	if err = c.Commit(title, body); err != nil {
+		return 0, err
+	}
+	if err = c.PushToCentral(branch, true); err != nil {
+		return 0, err
+	}
+
+	return s.Ghc.CreatePullRequest(gOrg, gRepo, title, body, branch, g.Branch, true)
+}
+
+// bumpTag sets the tag of image on a kustomization or helm values file. It
+// edits the lines in place so comments and formatting are kept
+func bumpTag(content []byte, format, image, tag string) ([]byte, bool, error) {
+	nameKey, tagKey := "name", "newTag"
+	if format == FormatHelm {
+		nameKey, tagKey = "repository", "tag"
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		y, ok := parseYAMLLine(line)
+		if !ok || y.key != nameKey || y.value != image {
+			continue
+		}
+
+		j := findSibling(lines, i, y, tagKey)
+		if j < 0 {
+			return nil, false, fmt.Errorf("%v of %v not found", tagKey, image)
+		}
+
+		t, _ := parseYAMLLine(lines[j])
+		if t.value == tag {
+			return content, false, nil
+		}
+		lines[j] = t.prefix + fmt.Sprintf(" %q", tag) + t.comment
+		return []byte(strings.Join(lines, "\n")), true, nil
+	}
+	return nil, false, fmt.Errorf("image %v not found", image)
+}
+
+type yamlLine struct {
+	indent   int
+	listItem bool
+	key      string
+	value    string
+	// prefix is the line up to the colon after the key
+	prefix string
+	// comment is the trailing comment with the spaces before it
+	comment string
+}
+
+// parseYAMLLine reads a `key: value` line, list items and quotes included
+func parseYAMLLine(line string) (yamlLine, bool) {
+	y := yamlLine{}
+	trimmed := strings.TrimLeft(line, " ")
+	if strings.HasPrefix(trimmed, "- ") {
+		y.listItem = true
+		trimmed = strings.TrimLeft(trimmed[2:], " ")
+	}
+	y.indent = len(line) - len(trimmed)
+
+	colon := strings.Index(trimmed, ":")
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || colon < 0 {
+		return y, false
+	}
+
+	y.key = trimmed[:colon]
+	y.prefix = line[:y.indent+colon+1]
+	value := trimmed[colon+1:]
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimRight(value[:i], " ")
+		y.comment = trimmed[colon+1+len(value):]
+	}
+	y.value = strings.Trim(strings.TrimSpace(value), `"'`)
+	return y, true
+}
+
+// findSibling looks for key on the same mapping as the line i
+func findSibling(lines []string, i int, y yamlLine, key string) int {
+	for j := i + 1; j < len(lines); j++ {
+		s, ok := parseYAMLLine(lines[j])
+		if !ok {
+			continue
+		}
+		if s.indent < y.indent || (s.listItem && s.indent == y.indent) {
+			break
+		}
+		if s.indent == y.indent && s.key == key {
+			return j
+		}
+	}
+
+	if y.listItem {
+		return -1
+	}
+
+	for j := i - 1; j >= 0; j-- {
+		s, ok := parseYAMLLine(lines[j])
+		if !ok {
+			continue
+		}
+		if s.indent < y.indent {
+			break
+		}
+		if s.indent == y.indent && s.key == key {
+			return j
+		}
+		if s.listItem && s.indent == y.indent {
+			break
+		}
+	}
+	return -1
+}
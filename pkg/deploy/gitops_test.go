@@ -0,0 +1,218 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBumpTag(t *testing.T) {
+	kustomization := `resources:
+- deployment.yaml
+images:
+  - name: quay.io/dafiti/api
+    newTag: "1a2b3c4"
+  - name: quay.io/dafiti/worker # the worker
+    newName: quay.io/dafiti/worker-v2
+    newTag: 'old'
+  - name: quay.io/dafiti/cron
+    newTag: v1  # pinned until the migration
+`
+
+	tests := []struct {
+		name     string
+		content  string
+		format   string
+		image    string
+		tag      string
+		expected string
+		changed  bool
+		wantErr  bool
+	}{
+		{
+			name:     "kustomize list item",
+			content:  kustomization,
+			format:   FormatKustomize,
+			image:    "quay.io/dafiti/api",
+			tag:      "5d6e7f8",
+			expected: strings.Replace(kustomization, `newTag: "1a2b3c4"`, `newTag: "5d6e7f8"`, 1),
+			changed:  true,
+		},
+		{
+			name:     "kustomize item with comment and other keys",
+			content:  kustomization,
+			format:   FormatKustomize,
+			image:    "quay.io/dafiti/worker",
+			tag:      "5d6e7f8",
+			expected: strings.Replace(kustomization, `newTag: 'old'`, `newTag: "5d6e7f8"`, 1),
+			changed:  true,
+		},
+		{
+			name:     "trailing comment is kept",
+			content:  kustomization,
+			format:   FormatKustomize,
+			image:    "quay.io/dafiti/cron",
+			tag:      "5d6e7f8",
+			expected: strings.Replace(kustomization, `newTag: v1  #`, `newTag: "5d6e7f8"  #`, 1),
+			changed:  true,
+		},
+		{
+			name:     "tag already set",
+			content:  kustomization,
+			format:   FormatKustomize,
+			image:    "quay.io/dafiti/api",
+			tag:      "1a2b3c4",
+			expected: kustomization,
+		},
+		{
+			name:    "unknown image",
+			content: kustomization,
+			format:  FormatKustomize,
+			image:   "quay.io/dafiti/web",
+			tag:     "5d6e7f8",
+			wantErr: true,
+		},
+		{
+			name:     "helm tag before the repository",
+			content:  "image:\n  tag: v1 # bumped by prow\n  repository: quay.io/dafiti/api\n  pullPolicy: Always\n",
+			format:   FormatHelm,
+			image:    "quay.io/dafiti/api",
+			tag:      "v2",
+			expected: "image:\n  tag: \"v2\" # bumped by prow\n  repository: quay.io/dafiti/api\n  pullPolicy: Always\n",
+			changed:  true,
+		},
+		{
+			name:     "helm nested values keep the other tags",
+			content:  "api:\n  image:\n    repository: quay.io/dafiti/api\n    tag: v1\nworker:\n  image:\n    repository: quay.io/dafiti/worker\n    tag: v1\n",
+			format:   FormatHelm,
+			image:    "quay.io/dafiti/worker",
+			tag:      "v2",
+			expected: "api:\n  image:\n    repository: quay.io/dafiti/api\n    tag: v1\nworker:\n  image:\n    repository: quay.io/dafiti/worker\n    tag: \"v2\"\n",
+			changed:  true,
+		},
+		{
+			name:    "helm tag of another mapping is not used",
+			content: "image:\n  repository: quay.io/dafiti/api\nsidecar:\n  tag: v1\n",
+			format:  FormatHelm,
+			image:   "quay.io/dafiti/api",
+			tag:     "v2",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content, changed, err := bumpTag([]byte(tc.content), tc.format, tc.image, tc.tag)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if changed != tc.changed {
+				t.Errorf("expected changed %v, got %v", tc.changed, changed)
+			}
+			if string(content) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, content)
+			}
+		})
+	}
+}
+
+func TestFindSibling(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		line     int
+		key      string
+		expected int
+	}{
+		{
+			name:     "after the line",
+			lines:    []string{"image:", "  repository: api", "  tag: v1"},
+			line:     1,
+			key:      "tag",
+			expected: 2,
+		},
+		{
+			name:     "before the line",
+			lines:    []string{"image:", "  tag: v1", "  repository: api"},
+			line:     2,
+			key:      "tag",
+			expected: 1,
+		},
+		{
+			name:     "blank lines and comments are skipped",
+			lines:    []string{"image:", "  repository: api", "", "  # the tag", "  tag: v1"},
+			line:     1,
+			key:      "tag",
+			expected: 4,
+		},
+		{
+			name:     "deeper keys are not siblings",
+			lines:    []string{"image:", "  repository: api", "  extra:", "    tag: v1"},
+			line:     1,
+			key:      "tag",
+			expected: -1,
+		},
+		{
+			name:     "list items stop at the next item",
+			lines:    []string{"images:", "- name: api", "- name: worker", "  newTag: v1"},
+			line:     1,
+			key:      "newTag",
+			expected: -1,
+		},
+		{
+			name:     "before the line on the same list item",
+			lines:    []string{"images:", "- newTag: v1", "  name: api"},
+			line:     2,
+			key:      "newTag",
+			expected: 1,
+		},
+		{
+			name:     "before the line stops at the list item start",
+			lines:    []string{"images:", "- newTag: v1", "- other: x", "  name: api"},
+			line:     3,
+			key:      "newTag",
+			expected: -1,
+		},
+		{
+			name:     "list items only look after the line",
+			lines:    []string{"images:", "  newTag: v1", "- name: api"},
+			line:     2,
+			key:      "newTag",
+			expected: -1,
+		},
+		{
+			name:     "list item",
+			lines:    []string{"images:", "  - name: api", "    newTag: v1"},
+			line:     1,
+			key:      "newTag",
+			expected: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			y, ok := parseYAMLLine(tc.lines[tc.line])
+			if !ok {
+				t.Fatalf("line %q is not a key", tc.lines[tc.line])
+			}
+			if j := findSibling(tc.lines, tc.line, y, tc.key); j != tc.expected {
+				t.Errorf("expected line %v, got %v", tc.expected, j)
+			}
+		})
+	}
+}
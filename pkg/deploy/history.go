@@ -0,0 +1,226 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of a deploy job
+type Outcome string
+
+const (
+	OutcomePending Outcome = "pending"
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+
+	// historyLimit is how many records are kept for each environment
+	historyLimit = 100
+)
+
+// Record is a single deploy of a SHA to an environment
+type Record struct {
+	ID          string     `json:"id"`
+	Org         string     `json:"org"`
+	Repo        string     `json:"repo"`
+	Environment string     `json:"environment"`
+	Ref         string     `json:"ref"`
+	SHA         string     `json:"sha"`
+	PR          int        `json:"pr"`
+	Author      string     `json:"author"`
+	Job         string     `json:"job"`
+	Rollback    bool       `json:"rollback"`
+	Outcome     Outcome    `json:"outcome"`
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+
+	// ForcedFreeze is the message of the freeze a release manager forced
+	ForcedFreeze string `json:"forcedFreeze,omitempty"`
+	// PromotedFrom is the environment the SHA was promoted from
+	PromotedFrom string `json:"promotedFrom,omitempty"`
+}
+
+// History stores deploy records, optionally persisted to a json file
+type History struct {
+	path    string
+	lock    sync.RWMutex
+	records []Record
+}
+
+// NewHistory loads the history from path, an empty path keeps it in memory
+func NewHistory(path string) (*History, error) {
+	h := &History{path: path}
+	if path == "" {
+		return h, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &h.records); err != nil {
+		return nil, fmt.Errorf("failed to parse deploy history %v: %v", path, err)
+	}
+	return h, nil
+}
+
+// Add appends a record and trims the environment history to historyLimit
+func (h *History) Add(r Record) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.records = append(h.records, r)
+
+	drop := -historyLimit
+	for _, rec := range h.records {
+		if rec.matches(r.Org, r.Repo, r.Environment) {
+			drop++
+		}
+	}
+
+	kept := h.records[:0]
+	for _, rec := range h.records {
+		if drop > 0 && rec.matches(r.Org, r.Repo, r.Environment) {
+			drop--
+			continue
+		}
+		kept = append(kept, rec)
+	}
+	h.records = kept
+
+	return h.save()
+}
+
+// SetOutcome updates the outcome of the record with the given id
+func (h *History) SetOutcome(id string, outcome Outcome) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i := range h.records {
+		if h.records[i].ID != id {
+			continue
+		}
+		now := time.Now()
+		h.records[i].Outcome = outcome
+		h.records[i].FinishedAt = &now
+		return h.save()
+	}
+	return fmt.Errorf("deploy record %v not found", id)
+}
+
+// List returns the records of an environment, newest first, empty filters match everything
+func (h *History) List(org, repo, env string) []Record {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	var records []Record
+	for i := len(h.records) - 1; i >= 0; i-- {
+		if h.records[i].matches(org, repo, env) {
+			records = append(records, h.records[i])
+		}
+	}
+	return records
+}
+
+// Latest returns the last deploy of an environment whatever its outcome
+func (h *History) Latest(org, repo, env string) *Record {
+	if records := h.List(org, repo, env); len(records) > 0 {
+		return &records[0]
+	}
+	return nil
+}
+
+// Current returns the last successful deploy of an environment
+func (h *History) Current(org, repo, env string) *Record {
+	for _, r := range h.List(org, repo, env) {
+		if r.Outcome == OutcomeSuccess {
+			return &r
+		}
+	}
+	return nil
+}
+
+// PreviousSuccess returns the last successful deploy before the current one
+func (h *History) PreviousSuccess(org, repo, env string) *Record {
+	current := h.Current(org, repo, env)
+	if current == nil {
+		return nil
+	}
+
+	for _, r := range h.List(org, repo, env) {
+		if r.Outcome != OutcomeSuccess || !r.StartedAt.Before(current.StartedAt) || r.SHA == current.SHA {
+			continue
+		}
+		return &r
+	}
+	return nil
+}
+
+// Find returns the newest successful deploy of sha, sha can be abbreviated
+func (h *History) Find(org, repo, env, sha string) *Record {
+	for _, r := range h.List(org, repo, env) {
+		if r.Outcome == OutcomeSuccess && strings.HasPrefix(r.SHA, sha) {
+			return &r
+		}
+	}
+	return nil
+}
+
+// ServeHTTP lists the history as json, filtered by the org, repo and env query params
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	records := h.List(q.Get("org"), q.Get("repo"), q.Get("env"))
+	if records == nil {
+		records = []Record{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(h.records)
+	if err != nil {
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+func (r Record) matches(org, repo, env string) bool {
+	return (org == "" || strings.EqualFold(r.Org, org)) &&
+		(repo == "" || strings.EqualFold(r.Repo, repo)) &&
+		(env == "" || strings.EqualFold(r.Environment, env))
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryAddTrims(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := NewHistory(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < historyLimit+5; i++ {
+		r := Record{Org: "org", Repo: "repo", Environment: "staging", SHA: fmt.Sprint(i), StartedAt: start.Add(time.Duration(i) * time.Minute)}
+		if err := h.Add(r); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := h.Add(Record{Org: "org", Repo: "repo", Environment: "production", SHA: "prod"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	staging := h.List("org", "repo", "staging")
+	if len(staging) != historyLimit {
+		t.Fatalf("expected %v staging records, got %v", historyLimit, len(staging))
+	}
+	if newest, oldest := staging[0].SHA, staging[len(staging)-1].SHA; newest != fmt.Sprint(historyLimit+4) || oldest != "5" {
+		t.Errorf("expected the records 5 to %v, got %v to %v", historyLimit+4, oldest, newest)
+	}
+	if production := h.List("org", "repo", "production"); len(production) != 1 {
+		t.Errorf("expected the production record to be kept, got %v", production)
+	}
+
+	// The trimmed history is what is loaded back
+	loaded, err := NewHistory(h.path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(loaded.List("org", "repo", "")); n != historyLimit+1 {
+		t.Errorf("expected %v records loaded, got %v", historyLimit+1, n)
+	}
+}
+
+func TestHistoryPreviousSuccess(t *testing.T) {
+	start := time.Now()
+	record := func(minute int, sha string, outcome Outcome) Record {
+		return Record{
+			Org:         "org",
+			Repo:        "repo",
+			Environment: "production",
+			SHA:         sha,
+			Outcome:     outcome,
+			StartedAt:   start.Add(time.Duration(minute) * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		records  []Record
+		expected string
+	}{
+		{
+			name: "no deploy",
+		},
+		{
+			name:    "only the current deploy",
+			records: []Record{record(0, "a", OutcomeSuccess)},
+		},
+		{
+			name:     "previous success",
+			records:  []Record{record(0, "a", OutcomeSuccess), record(1, "b", OutcomeSuccess)},
+			expected: "a",
+		},
+		{
+			name:     "failures are skipped",
+			records:  []Record{record(0, "a", OutcomeSuccess), record(1, "b", OutcomeFailure), record(2, "c", OutcomeSuccess)},
+			expected: "a",
+		},
+		{
+			name:     "deploys of the current sha are skipped",
+			records:  []Record{record(0, "a", OutcomeSuccess), record(1, "b", OutcomeSuccess), record(2, "b", OutcomeSuccess)},
+			expected: "a",
+		},
+		{
+			name:     "a pending deploy is not the current one",
+			records:  []Record{record(0, "a", OutcomeSuccess), record(1, "b", OutcomeSuccess), record(2, "c", OutcomePending)},
+			expected: "a",
+		},
+		{
+			name:    "other environments are ignored",
+			records: []Record{{Org: "org", Repo: "repo", Environment: "staging", SHA: "a", Outcome: OutcomeSuccess, StartedAt: start}, record(1, "b", OutcomeSuccess)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _ := NewHistory("")
+			for _, r := range tc.records {
+				if err := h.Add(r); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			var sha string
+			if r := h.PreviousSuccess("org", "repo", "production"); r != nil {
+				sha = r.SHA
+			}
+			if sha != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, sha)
+			}
+		})
+	}
+}
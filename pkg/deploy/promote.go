@@ -0,0 +1,104 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	promoteRe = regexp.MustCompile(`(?mi)^/promote\s+(\S+)\s+(\S+)(\s+--force-freeze)?\s*$`)
+
+	noPromotionMsg    = "**%v** does not accept promotions"
+	wrongPromotionMsg = "**%v** is promoted from **%v**, not from **%v**"
+	nothingToPromote  = "There is no deploy of **%v** to promote"
+	notSucceededMsg   = "The last deploy of **%v**, `%v`, is **%v** and can't be promoted"
+	soakingMsg        = "`%v` is on **%v** for %v, it must soak for %v before being promoted"
+	promotingMsg      = "Promoting `%v` from **%v** to **%v**"
+)
+
+func (s *Server) handlePromote(l *logrus.Entry, org, repo string, number int, user, fromName, toName string, force bool) (err error) {
+	from, err := s.Config.Environment(org, repo, fromName)
+	if err != nil {
+		return s.notice(org, repo, number, err.Error())
+	}
+
+	to, err := s.Config.Environment(org, repo, toName)
+	if err != nil {
+		return s.notice(org, repo, number, err.Error())
+	}
+
+	source := s.History.Latest(org, repo, from.Name)
+	if msg := checkPromotion(from, to, source, time.Now()); msg != "" {
+		return s.notice(org, repo, number, msg)
+	}
+
+	pr, err := s.Ghc.GetPullRequest(org, repo, number)
+	if err != nil {
+		l.WithError(err).Error("failed to get pull request")
+		return err
+	}
+
+	r := Record{
+		Org:          org,
+		Repo:         repo,
+		Environment:  to.Name,
+		Ref:          source.Ref,
+		SHA:          source.SHA,
+		PR:           number,
+		Author:       user,
+		Job:          to.Job,
+		PromotedFrom: from.Name,
+	}
+
+	// Refuse during a freeze unless a release manager forces it
+	if ok, err := s.checkFreeze(l, &r, to, pr.Base.Ref, force); !ok {
+		return err
+	}
+
+	msg := fmt.Sprintf(promotingMsg, source.SHA, from.Name, to.Name)
+	if err = s.Ghc.CreateComment(org, repo, number, msg); err != nil {
+		return err
+	}
+
+	return s.startDeploy(l, r, to.Timeout)
+}
+
+// checkPromotion returns why source can't be promoted from one environment to
+// the other, promotions follow the configured order and the deploy running on
+// from must have succeeded and soaked
+func checkPromotion(from, to *Environment, source *Record, now time.Time) string {
+	if to.PromoteFrom == "" {
+		return fmt.Sprintf(noPromotionMsg, to.Name)
+	}
+	if !strings.EqualFold(to.PromoteFrom, from.Name) {
+		return fmt.Sprintf(wrongPromotionMsg, to.Name, to.PromoteFrom, from.Name)
+	}
+
+	if source == nil {
+		return fmt.Sprintf(nothingToPromote, from.Name)
+	}
+	if source.Outcome != OutcomeSuccess {
+		return fmt.Sprintf(notSucceededMsg, from.Name, source.SHA, source.Outcome)
+	}
+	if soaked := now.Sub(*source.FinishedAt); soaked < from.Soak {
+		return fmt.Sprintf(soakingMsg, source.SHA, from.Name, soaked.Round(time.Minute), from.Soak)
+	}
+	return ""
+}
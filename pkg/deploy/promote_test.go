@@ -0,0 +1,106 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCheckPromotion(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	finished := func(ago time.Duration, outcome Outcome) *Record {
+		at := now.Add(-ago)
+		return &Record{SHA: "1a2b3c4", Environment: "staging", Outcome: outcome, FinishedAt: &at}
+	}
+
+	var (
+		staging    = &Environment{Name: "staging", Soak: time.Hour}
+		qa         = &Environment{Name: "qa"}
+		production = &Environment{Name: "production", PromoteFrom: "Staging"}
+	)
+
+	tests := []struct {
+		name     string
+		from     *Environment
+		to       *Environment
+		source   *Record
+		expected string
+	}{
+		{
+			name:     "soaked success is promoted",
+			from:     staging,
+			to:       production,
+			source:   finished(2*time.Hour, OutcomeSuccess),
+			expected: "",
+		},
+		{
+			name:     "missing promoteFrom",
+			from:     staging,
+			to:       qa,
+			source:   finished(2*time.Hour, OutcomeSuccess),
+			expected: fmt.Sprintf(noPromotionMsg, "qa"),
+		},
+		{
+			name:     "wrong source environment",
+			from:     qa,
+			to:       production,
+			source:   finished(2*time.Hour, OutcomeSuccess),
+			expected: fmt.Sprintf(wrongPromotionMsg, "production", "Staging", "qa"),
+		},
+		{
+			name:     "nothing deployed on the source",
+			from:     staging,
+			to:       production,
+			expected: fmt.Sprintf(nothingToPromote, "staging"),
+		},
+		{
+			name:     "last deploy failed",
+			from:     staging,
+			to:       production,
+			source:   finished(2*time.Hour, OutcomeFailure),
+			expected: fmt.Sprintf(notSucceededMsg, "staging", "1a2b3c4", OutcomeFailure),
+		},
+		{
+			name:     "last deploy still running",
+			from:     staging,
+			to:       production,
+			source:   &Record{SHA: "1a2b3c4", Outcome: OutcomePending},
+			expected: fmt.Sprintf(notSucceededMsg, "staging", "1a2b3c4", OutcomePending),
+		},
+		{
+			name:     "soak not elapsed",
+			from:     staging,
+			to:       production,
+			source:   finished(20*time.Minute, OutcomeSuccess),
+			expected: fmt.Sprintf(soakingMsg, "1a2b3c4", "staging", 20*time.Minute, time.Hour),
+		},
+		{
+			name:     "soak just elapsed",
+			from:     staging,
+			to:       production,
+			source:   finished(time.Hour, OutcomeSuccess),
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if msg := checkPromotion(tc.from, tc.to, tc.source, now); msg != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, msg)
+			}
+		})
+	}
+}
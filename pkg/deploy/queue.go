@@ -0,0 +1,157 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	queuedMsg   = "Deploy of `%v` to **%v** is queued at position **%v**, waiting for %v\n<!-- %v -->"
+	dequeuedMsg = "Deploy of `%v` to **%v** left the queue and started\n<!-- %v -->"
+)
+
+// queuedDeploy is a deploy waiting for, or holding, its environment
+type queuedDeploy struct {
+	id      string
+	log     *logrus.Entry
+	record  Record
+	timeout time.Duration
+}
+
+// marker identifies the queue comment of the deploy so it can be edited
+func (d *queuedDeploy) marker() string {
+	return "deploy-queue:" + d.id
+}
+
+// Queue serializes deploys per environment, the head of each queue is the
+// deploy that is running and the others wait for it in order
+type Queue struct {
+	lock    sync.Mutex
+	seq     int
+	deploys map[string][]*queuedDeploy
+}
+
+// NewQueue returns an empty deploy queue
+func NewQueue() *Queue {
+	return &Queue{deploys: map[string][]*queuedDeploy{}}
+}
+
+// Push adds a deploy to its environment queue and returns how many deploys are ahead of it
+func (q *Queue) Push(d *queuedDeploy) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.seq++
+	d.id = fmt.Sprintf("%v-%v", time.Now().Unix(), q.seq)
+
+	key := queueKey(d.record)
+	q.deploys[key] = append(q.deploys[key], d)
+	return len(q.deploys[key]) - 1
+}
+
+// Pop releases the environment and returns the next deploy and the ones still waiting
+func (q *Queue) Pop(key string) (*queuedDeploy, []*queuedDeploy) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	deploys := q.deploys[key]
+	if len(deploys) <= 1 {
+		delete(q.deploys, key)
+		return nil, nil
+	}
+
+	q.deploys[key] = deploys[1:]
+	return deploys[1], deploys[2:]
+}
+
+func queueKey(r Record) string {
+	return strings.ToLower(fmt.Sprintf("%v/%v/%v", r.Org, r.Repo, r.Environment))
+}
+
+// enqueue runs the deploy right away if the environment is idle, otherwise
+// it comments the queue position
+func (s *Server) enqueue(d *queuedDeploy) error {
+	position := s.Queue.Push(d)
+	if position == 0 {
+		return s.runDeploy(d)
+	}
+
+	r := d.record
+	msg := fmt.Sprintf(queuedMsg, r.SHA, r.Environment, position, pluralDeploys(position), d.marker())
+	return s.Ghc.CreateComment(r.Org, r.Repo, r.PR, msg)
+}
+
+// next releases the environment of r, starts the next deploy and moves the
+// others up in their queue comments
+func (s *Server) next(r Record) {
+	next, waiting := s.Queue.Pop(queueKey(r))
+	if next == nil {
+		return
+	}
+
+	for i, d := range waiting {
+		position := i + 1
+		msg := fmt.Sprintf(queuedMsg, d.record.SHA, d.record.Environment, position, pluralDeploys(position), d.marker())
+		if err := s.editQueueComment(d, msg); err != nil {
+			d.log.WithError(err).Warn("failed to update queue comment")
+		}
+	}
+
+	// A deploy that can't start reports it on its queue comment
+	if err := s.runDeploy(next); err != nil {
+		next.log.WithError(err).Error("failed to start queued deploy")
+		return
+	}
+	msg := fmt.Sprintf(dequeuedMsg, next.record.SHA, next.record.Environment, next.marker())
+	if err := s.editQueueComment(next, msg); err != nil {
+		next.log.WithError(err).Warn("failed to update queue comment")
+	}
+}
+
+// editQueueComment replaces the queue comment of the deploy, deploys that
+// never waited have none so it is created
+func (s *Server) editQueueComment(d *queuedDeploy, body string) error {
+	botName, err := s.Ghc.BotName()
+	if err != nil {
+		return err
+	}
+
+	r := d.record
+	comments, err := s.Ghc.ListIssueComments(r.Org, r.Repo, r.PR)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		if github.NormLogin(c.User.Login) == github.NormLogin(botName) && strings.Contains(c.Body, d.marker()) {
+			return s.Ghc.EditComment(r.Org, r.Repo, c.ID, body)
+		}
+	}
+	return s.Ghc.CreateComment(r.Org, r.Repo, r.PR, body)
+}
+
+func pluralDeploys(n int) string {
+	if n == 1 {
+		return "1 deploy"
+	}
+	return fmt.Sprintf("%v deploys", n)
+}
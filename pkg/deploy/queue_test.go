@@ -0,0 +1,273 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeGithub keeps the comments of each pull request in memory
+type fakeGithub struct {
+	github.Client
+	comments map[int][]github.IssueComment
+	id       int
+}
+
+func (f *fakeGithub) BotName() (string, error) {
+	return "bot", nil
+}
+
+func (f *fakeGithub) CreateComment(org, repo string, number int, body string) error {
+	f.id++
+	f.comments[number] = append(f.comments[number], github.IssueComment{ID: f.id, Body: body, User: github.User{Login: "bot"}})
+	return nil
+}
+
+func (f *fakeGithub) EditComment(org, repo string, id int, body string) error {
+	for number, comments := range f.comments {
+		for i := range comments {
+			if comments[i].ID == id {
+				f.comments[number][i].Body = body
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("comment %v not found", id)
+}
+
+func (f *fakeGithub) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	return f.comments[number], nil
+}
+
+// fakeProwJobs records the sha of the created deploy jobs and refuses the failing ones
+type fakeProwJobs struct {
+	prowv1.ProwJobInterface
+	created []string
+	failing sets.String
+}
+
+func (f *fakeProwJobs) Create(pj *prowapi.ProwJob) (*prowapi.ProwJob, error) {
+	if f.failing.Has(pj.Spec.Refs.BaseSHA) {
+		return nil, errors.New("boom")
+	}
+	f.created = append(f.created, pj.Spec.Refs.BaseSHA)
+	return pj, nil
+}
+
+func newTestServer(pjc *fakeProwJobs) *Server {
+	ca := &config.Agent{}
+	ca.Set(&config.Config{JobConfig: config.JobConfig{
+		PostsubmitsStatic: map[string][]config.Postsubmit{
+			"org/repo": {{JobBase: config.JobBase{Name: "deploy-staging"}}},
+		},
+	}})
+
+	history, _ := NewHistory("")
+	return &Server{
+		ConfigAgent: ca,
+		Ghc:         &fakeGithub{comments: map[int][]github.IssueComment{}},
+		PJc:         pjc,
+		Config:      &Config{},
+		History:     history,
+		Queue:       NewQueue(),
+		Log:         logrus.NewEntry(logrus.New()),
+	}
+}
+
+// stagingDeploy is a deploy of sha to staging requested on pull request pr
+func stagingDeploy(pr int, sha string) *queuedDeploy {
+	return &queuedDeploy{
+		log:     logrus.NewEntry(logrus.New()),
+		record:  Record{Org: "org", Repo: "repo", Environment: "staging", SHA: sha, PR: pr, Job: "deploy-staging"},
+		timeout: time.Hour,
+	}
+}
+
+var markerRe = regexp.MustCompile(`<!-- deploy-queue:\S+ -->`)
+
+// bodies returns the comments of each pull request without the queue markers
+func bodies(ghc *fakeGithub) map[int][]string {
+	b := map[int][]string{}
+	for number, comments := range ghc.comments {
+		for _, c := range comments {
+			b[number] = append(b[number], markerRe.ReplaceAllString(c.Body, "<!-- marker -->"))
+		}
+	}
+	return b
+}
+
+func TestQueueNext(t *testing.T) {
+	var (
+		started = func(sha string) string {
+			return fmt.Sprintf(deployStartedMsg, sha, "staging", "deploy-staging")
+		}
+		queued = func(sha string, position int) string {
+			return fmt.Sprintf(queuedMsg, sha, "staging", position, pluralDeploys(position), "marker")
+		}
+		dequeued = func(sha string) string {
+			return fmt.Sprintf(dequeuedMsg, sha, "staging", "marker")
+		}
+		failed = func(sha string) string {
+			return fmt.Sprintf(deployFailedMsg, sha, "staging", "boom", "marker")
+		}
+	)
+
+	tests := []struct {
+		name    string
+		deploys []string
+		failing sets.String
+		// finished is how many deploys finish before the later ones are requested
+		finished int
+		later    []string
+		started  []string
+		comments map[int][]string
+	}{
+		{
+			name:     "idle environment starts right away",
+			deploys:  []string{"a"},
+			started:  []string{"a"},
+			comments: map[int][]string{1: {started("a")}},
+		},
+		{
+			name:    "waiting deploys get their position",
+			deploys: []string{"a", "b", "c"},
+			started: []string{"a"},
+			comments: map[int][]string{
+				1: {started("a")},
+				2: {queued("b", 1)},
+				3: {queued("c", 2)},
+			},
+		},
+		{
+			name:     "finished deploy starts the next and moves the others up",
+			deploys:  []string{"a", "b", "c"},
+			finished: 1,
+			started:  []string{"a", "b"},
+			comments: map[int][]string{
+				1: {started("a")},
+				2: {dequeued("b"), started("b")},
+				3: {queued("c", 1)},
+			},
+		},
+		{
+			name:     "released environment runs new deploys right away",
+			deploys:  []string{"a"},
+			finished: 1,
+			later:    []string{"b"},
+			started:  []string{"a", "b"},
+			comments: map[int][]string{
+				1: {started("a")},
+				2: {started("b")},
+			},
+		},
+		{
+			name:     "queued deploy that fails to start reports it and releases the environment",
+			deploys:  []string{"a", "b", "c"},
+			failing:  sets.NewString("b"),
+			finished: 1,
+			started:  []string{"a", "c"},
+			comments: map[int][]string{
+				1: {started("a")},
+				2: {failed("b")},
+				3: {dequeued("c"), started("c")},
+			},
+		},
+		{
+			name:    "deploy on an idle environment that fails to start releases it",
+			deploys: []string{"a"},
+			failing: sets.NewString("a"),
+			later:   []string{"b"},
+			started: []string{"b"},
+			comments: map[int][]string{
+				1: {failed("a")},
+				2: {started("b")},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pjc := &fakeProwJobs{failing: tc.failing}
+			s := newTestServer(pjc)
+
+			pr := 0
+			enqueue := func(shas []string) {
+				for _, sha := range shas {
+					pr++
+					if err := s.enqueue(stagingDeploy(pr, sha)); err != nil && !tc.failing.Has(sha) {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+			}
+
+			enqueue(tc.deploys)
+			for i := 0; i < tc.finished; i++ {
+				s.next(stagingDeploy(0, "").record)
+			}
+			enqueue(tc.later)
+
+			if !reflect.DeepEqual(pjc.created, tc.started) {
+				t.Errorf("expected started %v, got %v", tc.started, pjc.created)
+			}
+			if comments := bodies(s.Ghc.(*fakeGithub)); !reflect.DeepEqual(comments, tc.comments) {
+				t.Errorf("expected comments %q, got %q", tc.comments, comments)
+			}
+		})
+	}
+}
+
+func TestResumeHoldsRunningDeploys(t *testing.T) {
+	pjc := &fakeProwJobs{}
+	s := newTestServer(pjc)
+
+	pending := Record{ID: "1", Org: "org", Repo: "repo", Environment: "staging", SHA: "a", PR: 1, Outcome: OutcomePending, StartedAt: time.Now()}
+	finished := Record{ID: "2", Org: "org", Repo: "repo", Environment: "production", SHA: "a", PR: 1, Outcome: OutcomeSuccess, StartedAt: time.Now()}
+	for _, r := range []Record{pending, finished} {
+		if err := s.History.Add(r); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	s.Resume()
+
+	if err := s.enqueue(stagingDeploy(2, "b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pjc.created) != 0 {
+		t.Errorf("expected the deploy to wait for the running one, started %v", pjc.created)
+	}
+	expected := map[int][]string{2: {fmt.Sprintf(queuedMsg, "b", "staging", 1, pluralDeploys(1), "marker")}}
+	if comments := bodies(s.Ghc.(*fakeGithub)); !reflect.DeepEqual(comments, expected) {
+		t.Errorf("expected comments %q, got %q", expected, comments)
+	}
+
+	// Finished deploys don't hold their environment
+	production := stagingDeploy(3, "c")
+	production.record.Environment = "production"
+	if position := s.Queue.Push(production); position != 0 {
+		t.Errorf("expected production to be idle, got position %v", position)
+	}
+}
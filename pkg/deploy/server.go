@@ -14,76 +14,93 @@ limitations under the License.
 package deploy
 
 import (
-	"encoding/json"
-	"fmt"
+	"flag"
 	"net/http"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
-	"github.com/k0kubun/pp"
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
+	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pluginhelp"
-	"k8s.io/test-infra/prow/plugins"
 	"k8s.io/test-infra/prow/repoowners"
 )
 
+const (
+	// noticeMarker tags the replies that only matter until the pull request changes
+	noticeMarker = "<!-- deploy-notice -->"
+)
+
 type Server struct {
-	Oc             *repoowners.Client
-	Pa             *plugins.ConfigAgent
-	TokenGenerator func() []byte
-	ConfigAgent    *config.Agent
-	Gc             git.ClientFactory
-	Ghc            github.Client
-	Log            *logrus.Entry
+	Oc          *repoowners.Client
+	ConfigAgent *config.Agent
+	Gc          git.ClientFactory
+	Ghc         github.Client
+	PJc         prowv1.ProwJobInterface
+	Config      *Config
+	History     *History
+	Queue       *Queue
+	Log         *logrus.Entry
+
+	configPath  string
+	historyPath string
 }
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, s.TokenGenerator)
-	if !ok {
-		s.Log.Error("validate webhook failed")
-		return
-	}
-
-	// Respond with
-	if err := s.handleEvent(eventType, eventGUID, payload); err != nil {
-		s.Log.WithError(err).Error("Error parsing event.")
-		fmt.Fprint(w, "Something went wrong")
-		return
-	}
-
-	s.Log.Info("handle event ok")
-	fmt.Fprint(w, "Event received. Have a nice day.")
+func init() {
+	plugin.Register(&Server{})
 }
 
-func (s *Server) handleEvent(eventType, eventGUID string, payload []byte) (err error) {
-	l := s.Log.WithFields(
-		logrus.Fields{
-			"event-type":     eventType,
-			github.EventGUID: eventGUID,
-		},
-	)
+// Name is the name of the plugin on plugins.yaml
+func (s *Server) Name() string {
+	return "deploy"
+}
 
-	switch eventType {
-	case "pull_request":
-		var p github.PullRequestEvent
+// Path is the legacy endpoint of the plugin
+func (s *Server) Path() string {
+	return "/deploy"
+}
 
-		if err := json.Unmarshal(payload, &p); err != nil {
-			return err
-		}
+// AddFlags registers the config and history flags
+func (s *Server) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.configPath, "deploy-config", "", "Path to the deploy plugin config file.")
+	fs.StringVar(&s.historyPath, "deploy-history-path", "", "Path to the file where the deploy history is kept, empty keeps it in memory.")
+}
 
-		go func() {
-			if err := s.handlePR(l, &p); err != nil {
-				s.Log.WithError(err).WithFields(l.Data).Info("Refreshing github statuses failed.")
-			}
-		}()
-	default:
-		s.Log.Debugf("skipping event of type %q", eventType)
+// Init loads the config and the history and takes the shared clients
+func (s *Server) Init(a plugin.Agent) (err error) {
+	if s.Config, err = LoadConfig(s.configPath); err != nil {
+		return err
 	}
+	if s.History, err = NewHistory(s.historyPath); err != nil {
+		return err
+	}
+	s.Queue = NewQueue()
+	s.ConfigAgent = a.ConfigAgent
+	s.Gc = a.Gc
+	s.Ghc = a.Ghc
+	s.Oc = a.Oc
+	s.PJc = a.PJc
+	s.Log = a.Log
 	return nil
 }
 
+// Handlers are the typed event handlers of the plugin
+func (s *Server) Handlers() plugin.Handlers {
+	return plugin.Handlers{
+		IssueComment: s.handleComment,
+		PullRequest:  s.handlePR,
+	}
+}
+
+// Start resumes the pending deploys and serves the history
+func (s *Server) Start(mux *http.ServeMux) {
+	s.Resume()
+	mux.Handle("/deploy/history", s.History)
+}
+
 func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err error) {
 	var (
 		org    = p.Repo.Owner.Login
@@ -91,7 +108,6 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 		number = p.Number
 		title  = p.PullRequest.Title
 		action = p.Action
-		// msg    = "This pull request does not have a jira tag on the title"
 	)
 
 	// Setup Logger
@@ -102,8 +118,11 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 		"title":             title,
 	})
 
-	// Only consider newly merged PRs
+	// Merged PRs bump the gitops repos, other closed ones are ignored
 	if action == github.PullRequestActionClosed {
+		if p.PullRequest.Merged {
+			return s.handleMerged(l, p)
+		}
 		l.Infof("Pull Request Action '%v' not aplicable", p.Action)
 		return nil
 	}
@@ -112,83 +131,55 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 	botName, err := s.Ghc.BotName()
 	if err != nil {
 		l.WithError(err).Error("failed getting botName")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	// Clear previous comments
 	if err = s.Ghc.DeleteStaleComments(org, repo, number, nil, shouldPrune(botName)); err != nil {
 		l.WithError(err).Error("failed to prune comments")
-		return err
+		return plugin.Retryable(err)
 	}
 
-	pp.Println("HY")
-	l.Info("Handle PR")
-
-	// pluginAgent := s.Pa
-	// if pluginAgent == nil {
-	// 	return errors.New("Could not get Plugin Agent in checkmarx")
-	// }
-
-	// config := pluginAgent.Config()
-	// if config == nil {
-	// 	return errors.New("Could not get Configuration in checkmarx")
-	// }
-
-	// if orgs, repos := config.EnabledReposForExternalPlugin("deploy"); orgs != nil || repos != nil {
-	// 	found := false
-	// 	repoOrg := fmt.Sprintf("%v/%v", org, repo)
-	// 	for _, v := range repos {
-	// 		if v == repoOrg {
-	// 			found = true
-	// 		}
-	// 	}
-
-	// 	if found {
-	// 		l.Infof("%v is elegible", repoOrg)
-	// 	} else {
-	// 		err = fmt.Errorf("Org Repo '%v' not allowed", repoOrg)
-	// 		l.Error(err)
-	// 		return err
-	// 	}
-	// }
-
-	// err = s.Ghc.AddLabel(org, repo, number, InvalidLabel)
-	// if err != nil {
-	// 	l.WithError(err).Error("failed to add label")
-	// 	return err
-	// }
-	// l.Info("Label added %v", InvalidLabel)
-
-	// @TODO: Start checkmarx job
-	l.Info("Start prow job")
-	// @TODO: Create commentary to tell job status
-	// s.ghc.CreateComment(org, repo, number, msg)
-	// if err != nil {
-	// 	l.WithError(err).Error("failed to add label")
-	// 	return err
-	// }
-
-	// @TODO: Remove label when job is done
-	// err = s.Ghc.RemoveLabel(org, repo, number, InvalidLabel)
-	// if err != nil {
-	// 	l.WithError(err).Error("failed to remove label")
-	// 	return err
-	// }
-
 	l.Info("HandlePR end")
 	return nil
 }
 
-//
-func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
-	return &pluginhelp.PluginHelp{
-		Description: "The Jira checker plugin checks your PR name",
-	}, nil
+// Help describes the plugin and lists its commands
+func (s *Server) Help() *pluginhelp.PluginHelp {
+	pluginHelp := &pluginhelp.PluginHelp{
+		Description: "The deploy plugin runs the deploy job of an environment and keeps its history",
+	}
+	pluginHelp.AddCommand(pluginhelp.Command{
+		Usage:       "/deploy <env> [--force-freeze]",
+		Description: "Deploys the head of the pull request to the environment, release managers can deploy during a freeze with --force-freeze",
+		WhoCanUse:   "Organization members",
+		Examples:    []string{"/deploy staging", "/deploy production --force-freeze"},
+	})
+	pluginHelp.AddCommand(pluginhelp.Command{
+		Usage:       "/rollback <env> [to <sha>]",
+		Description: "Deploys the last successful deploy before the current one, or the given sha",
+		WhoCanUse:   "Organization members",
+		Examples:    []string{"/rollback production", "/rollback production to 1a2b3c4"},
+	})
+	pluginHelp.AddCommand(pluginhelp.Command{
+		Usage:       "/promote <from> <to> [--force-freeze]",
+		Description: "Deploys the sha running on an environment to the next one, once it succeeded and soaked",
+		WhoCanUse:   "Organization members",
+		Examples:    []string{"/promote staging production"},
+	})
+	return pluginHelp
+}
+
+// notice replies to a deploy command with a comment that is pruned once the
+// pull request changes, deploy, queue and bump comments are kept
+func (s *Server) notice(org, repo string, number int, msg string) error {
+	return s.Ghc.CreateComment(org, repo, number, msg+"\n"+noticeMarker)
 }
 
-//
+// shouldPrune only matches the notices, the bot is shared with other plugins
+// and the queue comments are edited as deploys move up
 func shouldPrune(botName string) func(github.IssueComment) bool {
 	return func(ic github.IssueComment) bool {
-		return github.NormLogin(botName) == github.NormLogin(ic.User.Login)
+		return github.NormLogin(botName) == github.NormLogin(ic.User.Login) && strings.Contains(ic.Body, noticeMarker)
 	}
 }
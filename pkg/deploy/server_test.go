@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploy
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestShouldPrune(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		body     string
+		expected bool
+	}{
+		{
+			name:     "notices",
+			user:     "bot",
+			body:     fmt.Sprintf(notMemberMsg, "alice", "org") + "\n" + noticeMarker,
+			expected: true,
+		},
+		{
+			name:     "bot login is case insensitive",
+			user:     "Bot",
+			body:     "**staging** is frozen\n" + noticeMarker,
+			expected: true,
+		},
+		{
+			name: "notices of other users",
+			user: "alice",
+			body: "copied\n" + noticeMarker,
+		},
+		{
+			name: "deploy started",
+			user: "bot",
+			body: fmt.Sprintf(deployStartedMsg, "1a2b3c4", "staging", "deploy-staging"),
+		},
+		{
+			name: "queue comments",
+			user: "bot",
+			body: fmt.Sprintf(queuedMsg, "1a2b3c4", "staging", 1, pluralDeploys(1), "deploy-queue:1"),
+		},
+		{
+			name: "failed starts",
+			user: "bot",
+			body: fmt.Sprintf(deployFailedMsg, "1a2b3c4", "staging", "boom", "deploy-queue:1"),
+		},
+		{
+			name: "bumps",
+			user: "bot",
+			body: fmt.Sprintf(bumpOpenedMsg, "org/manifests", 2, "quay.io/dafiti/api", "1a2b3c4"),
+		},
+		{
+			name: "comments of other plugins",
+			user: "bot",
+			body: "Teams were synced",
+		},
+	}
+
+	prune := shouldPrune("bot")
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := github.IssueComment{Body: tc.body, User: github.User{Login: tc.user}}
+			if pruned := prune(ic); pruned != tc.expected {
+				t.Errorf("expected pruned %v, got %v", tc.expected, pruned)
+			}
+		})
+	}
+}
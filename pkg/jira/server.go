@@ -14,28 +14,21 @@ limitations under the License.
 package jira
 
 import (
-	"encoding/json"
-	"fmt"
+	"flag"
 	"net/http"
 	"regexp"
 	"strings"
 
 	"github.com/sirupsen/logrus"
 
-	"k8s.io/test-infra/prow/config"
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pluginhelp"
-	"k8s.io/test-infra/prow/plugins"
-	"k8s.io/test-infra/prow/repoowners"
 )
 
 type Server struct {
-	Oc             *repoowners.Client
-	Pa             *plugins.ConfigAgent
-	TokenGenerator func() []byte
-	ConfigAgent    *config.Agent
-	Ghc            github.Client
-	Log            *logrus.Entry
+	Ghc github.Client
+	Log *logrus.Entry
 }
 
 const (
@@ -46,51 +39,45 @@ var (
 	titleRegex = regexp.MustCompile(`[A-Z]{1,}-\d+`)
 )
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, s.TokenGenerator)
-	if !ok {
-		s.Log.Error("validate webhook failed")
-		return
-	}
+func init() {
+	plugin.Register(&Server{})
+}
 
-	// Respond with
-	if err := s.handleEvent(eventType, eventGUID, payload); err != nil {
-		s.Log.WithError(err).Error("Error parsing event.")
-		fmt.Fprint(w, "Something went wrong")
-		return
-	}
+// Name is the name of the plugin on plugins.yaml
+func (s *Server) Name() string {
+	return "jira-checker"
+}
 
-	s.Log.Info("handle event ok")
-	fmt.Fprint(w, "Event received. Have a nice day.")
+// Path is the legacy endpoint of the plugin
+func (s *Server) Path() string {
+	return "/jira-checker"
 }
 
-func (s *Server) handleEvent(eventType, eventGUID string, payload []byte) (err error) {
-	l := s.Log.WithFields(
-		logrus.Fields{
-			"event-type":     eventType,
-			github.EventGUID: eventGUID,
-		},
-	)
+// AddFlags registers no flags, the plugin has no config
+func (s *Server) AddFlags(_ *flag.FlagSet) {}
 
-	switch eventType {
-	case "pull_request":
-		var p github.PullRequestEvent
+// Init takes the shared clients
+func (s *Server) Init(a plugin.Agent) error {
+	s.Ghc = a.Ghc
+	s.Log = a.Log
+	return nil
+}
 
-		if err := json.Unmarshal(payload, &p); err != nil {
-			return err
-		}
+// Handlers are the typed event handlers of the plugin
+func (s *Server) Handlers() plugin.Handlers {
+	return plugin.Handlers{PullRequest: s.handlePR}
+}
 
-		go func() {
-			if err := s.handlePR(l, &p); err != nil {
-				s.Log.WithError(err).WithFields(l.Data).Info("Refreshing github statuses failed.")
-			}
-		}()
-	default:
-		s.Log.Debugf("skipping event of type %q", eventType)
+// Help describes the plugin, it has no commands
+func (s *Server) Help() *pluginhelp.PluginHelp {
+	return &pluginhelp.PluginHelp{
+		Description: "The Jira checker plugin checks your PR name",
 	}
-	return nil
 }
 
+// Start has no background work
+func (s *Server) Start(_ *http.ServeMux) {}
+
 func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err error) {
 	var (
 		org    = p.Repo.Owner.Login
@@ -105,13 +92,13 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 	botName, err := s.Ghc.BotName()
 	if err != nil {
 		l.WithError(err).Error("failed getting botName")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	// Clear comments
 	if err = s.Ghc.DeleteStaleComments(org, repo, number, nil, shouldPrune(botName)); err != nil {
 		l.WithError(err).Error("failed to prune comments")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	// Setup Logger
@@ -130,31 +117,13 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 		return nil
 	}
 
-	if orgs, repos := s.Pa.Config().EnabledReposForExternalPlugin("jira-checker"); orgs != nil || repos != nil {
-		found := false
-		repoOrg := fmt.Sprintf("%v/%v", org, repo)
-		for _, v := range repos {
-			if v == repoOrg {
-				found = true
-			}
-		}
-
-		if found {
-			l.Infof("%v is elegible", repoOrg)
-		} else {
-			err = fmt.Errorf("Org Repo '%v' not allowed", repoOrg)
-			l.Error(err)
-			return err
-		}
-	}
-
 	jiraTag := titleRegex.FindString(title)
 
 	if jiraTag == "" {
 		err = s.Ghc.AddLabel(org, repo, number, InvalidLabel)
 		if err != nil {
 			l.WithError(err).Error("failed to add label")
-			return err
+			return plugin.Retryable(err)
 		}
 
 		// s.ghc.CreateComment(org, repo, number, msg)
@@ -170,19 +139,12 @@ func (s *Server) handlePR(l *logrus.Entry, p *github.PullRequestEvent) (err erro
 	err = s.Ghc.RemoveLabel(org, repo, number, InvalidLabel)
 	if err != nil {
 		l.WithError(err).Error("failed to remove label")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	return err
 }
 
-//
-func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
-	return &pluginhelp.PluginHelp{
-		Description: "The Jira checker plugin checks your PR name",
-	}, nil
-}
-
 //
 func shouldPrune(botName string) func(github.IssueComment) bool {
 	return func(ic github.IssueComment) bool {
@@ -0,0 +1,85 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var duplicateDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "prow_plugins_duplicate_deliveries_total",
+	Help: "Webhook deliveries skipped because the plugin already got their X-GitHub-Delivery id.",
+}, []string{"plugin"})
+
+func init() {
+	prometheus.MustRegister(duplicateDeliveries)
+}
+
+// Deliveries remembers the delivery ids seen in the last TTL, up to Size of
+// them, the oldest ones are forgotten first
+type Deliveries struct {
+	TTL  time.Duration
+	Size int
+
+	lock  sync.Mutex
+	seen  map[string]*list.Element
+	order *list.List
+}
+
+type delivery struct {
+	id   string
+	seen time.Time
+}
+
+// Seen records id and tells if it was already recorded
+func (d *Deliveries) Seen(id string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.seen == nil {
+		d.seen = map[string]*list.Element{}
+		d.order = list.New()
+	}
+
+	now := time.Now()
+	// Ids are recorded in order, so the expired ones are at the front
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		if now.Sub(front.Value.(delivery).seen) < d.TTL && d.order.Len() < d.Size {
+			break
+		}
+		delete(d.seen, front.Value.(delivery).id)
+		d.order.Remove(front)
+	}
+
+	if _, found := d.seen[id]; found {
+		return true
+	}
+	d.seen[id] = d.order.PushBack(delivery{id: id, seen: now})
+	return false
+}
+
+// Forget drops id, so a redelivery of an event that could not be stored is handled
+func (d *Deliveries) Forget(id string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if e, found := d.seen[id]; found {
+		d.order.Remove(e)
+		delete(d.seen, id)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeliveriesSeen(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		size int
+		// ids are recorded in order, wait apart
+		ids      []string
+		wait     time.Duration
+		forget   string
+		expected []bool
+	}{
+		{
+			name:     "redelivery is seen",
+			ttl:      time.Hour,
+			size:     10,
+			ids:      []string{"a", "b", "a"},
+			expected: []bool{false, false, true},
+		},
+		{
+			name:     "expired ids are forgotten",
+			ttl:      20 * time.Millisecond,
+			size:     10,
+			ids:      []string{"a", "a"},
+			wait:     30 * time.Millisecond,
+			expected: []bool{false, false},
+		},
+		{
+			name:     "the oldest id is evicted past the size",
+			ttl:      time.Hour,
+			size:     2,
+			ids:      []string{"a", "b", "c", "a"},
+			expected: []bool{false, false, false, false},
+		},
+		{
+			name:     "the newest ids are kept past the size",
+			ttl:      time.Hour,
+			size:     2,
+			ids:      []string{"a", "b", "c", "c"},
+			expected: []bool{false, false, false, true},
+		},
+		{
+			name:     "forgotten ids are handled again",
+			ttl:      time.Hour,
+			size:     10,
+			ids:      []string{"a", "a"},
+			forget:   "a",
+			expected: []bool{false, false},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &Deliveries{TTL: tc.ttl, Size: tc.size}
+			for i, id := range tc.ids {
+				time.Sleep(tc.wait)
+				if seen := d.Seen(id); seen != tc.expected[i] {
+					t.Errorf("expected %v seen %v at %v, got %v", id, tc.expected[i], i, seen)
+				}
+				if id == tc.forget {
+					d.Forget(id)
+				}
+			}
+			if n := d.order.Len(); n > tc.size || n != len(d.seen) {
+				t.Errorf("expected up to %v ids on both the list and the map, got %v and %v", tc.size, n, len(d.seen))
+			}
+		})
+	}
+}
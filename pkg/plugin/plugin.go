@@ -0,0 +1,114 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+
+	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/pluginhelp"
+	"k8s.io/test-infra/prow/plugins"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+// Plugin is a Dafiti plugin, its package registers it on init and the server
+// wires its routing, help and eligibility
+type Plugin interface {
+	// Name is the name of the plugin on plugins.yaml
+	Name() string
+	// Path is the endpoint the plugin is served on besides /hook
+	Path() string
+	// AddFlags registers the flags of the plugin config
+	AddFlags(fs *flag.FlagSet)
+	// Init loads the plugin config, once flags are parsed
+	Init(a Agent) error
+	// Handlers are the typed event handlers of the plugin
+	Handlers() Handlers
+	// Help describes the plugin and lists its commands
+	Help() *pluginhelp.PluginHelp
+	// Start runs the background work of the plugin and its extra endpoints
+	Start(mux *http.ServeMux)
+}
+
+// Agent holds the clients shared by every plugin
+type Agent struct {
+	Ghc         github.Client
+	Gc          git.ClientFactory
+	Oc          *repoowners.Client
+	Pa          *plugins.ConfigAgent
+	ConfigAgent *config.Agent
+	PJc         prowv1.ProwJobInterface
+	Log         *logrus.Entry
+}
+
+// Handlers are the typed handlers of a plugin, events without a handler are
+// skipped
+type Handlers struct {
+	IssueComment      func(l *logrus.Entry, e *github.IssueCommentEvent) error
+	PullRequest       func(l *logrus.Entry, e *github.PullRequestEvent) error
+	PullRequestReview func(l *logrus.Entry, e *github.ReviewEvent) error
+	Push              func(l *logrus.Entry, e *github.PushEvent) error
+}
+
+// Events returns the event types the plugin has a handler for
+func (h Handlers) Events() []string {
+	var events []string
+	if h.IssueComment != nil {
+		events = append(events, "issue_comment")
+	}
+	if h.PullRequest != nil {
+		events = append(events, "pull_request")
+	}
+	if h.PullRequestReview != nil {
+		events = append(events, "pull_request_review")
+	}
+	if h.Push != nil {
+		events = append(events, "push")
+	}
+	return events
+}
+
+var registry = map[string]Plugin{}
+
+// Register adds a plugin to the registry, names must be unique
+func Register(p Plugin) {
+	if _, found := registry[p.Name()]; found {
+		panic(fmt.Sprintf("plugin %q registered twice", p.Name()))
+	}
+	registry[p.Name()] = p
+}
+
+// Get returns the registered plugin by name
+func Get(name string) (Plugin, bool) {
+	p, found := registry[name]
+	return p, found
+}
+
+// Names returns the names of the registered plugins, sorted
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when a plugin has QueueSize jobs pending
+	ErrQueueFull = errors.New("plugin queue is full")
+	// ErrDraining is returned once the pool stops taking jobs
+	ErrDraining = errors.New("plugin pool is draining")
+)
+
+// Pool runs the plugin handlers on a bounded number of workers per plugin.
+// Jobs with the same key run one after the other, in the order they came
+type Pool struct {
+	// Workers is the number of workers of each plugin, Limits overrides it
+	// by plugin name
+	Workers int
+	Limits  map[string]int
+	// QueueSize bounds the pending jobs of each plugin
+	QueueSize int
+
+	mu       sync.Mutex
+	queues   map[string]chan job
+	pending  map[string]int
+	waiting  map[string][]job
+	draining bool
+	wg       sync.WaitGroup
+}
+
+type job struct {
+	plugin string
+	key    string
+	run    func()
+}
+
+// Submit queues run on the workers of plugin, behind the jobs with the same
+// key, an empty key is never serialized
+func (p *Pool) Submit(plugin, key string, run func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.draining {
+		return ErrDraining
+	}
+	if p.pending[plugin] >= p.QueueSize {
+		return fmt.Errorf("%v: %w", plugin, ErrQueueFull)
+	}
+
+	q := p.queue(plugin)
+	j := job{plugin: plugin, run: run}
+	if key != "" {
+		j.key = plugin + "/" + key
+		// The worker running the key picks the job up once it is done
+		if waiting, running := p.waiting[j.key]; running {
+			p.waiting[j.key] = append(waiting, j)
+			p.add(plugin)
+			return nil
+		}
+		p.waiting[j.key] = nil
+	}
+
+	q <- j
+	p.add(plugin)
+	return nil
+}
+
+func (p *Pool) add(plugin string) {
+	p.pending[plugin]++
+	p.wg.Add(1)
+}
+
+// queue returns the queue of the plugin, starting its workers the first time
+func (p *Pool) queue(plugin string) chan job {
+	if p.queues == nil {
+		p.queues = map[string]chan job{}
+		p.pending = map[string]int{}
+		p.waiting = map[string][]job{}
+	}
+	if q, found := p.queues[plugin]; found {
+		return q
+	}
+
+	workers := p.Workers
+	if limit, found := p.Limits[plugin]; found {
+		workers = limit
+	}
+	// Pending jobs never exceed QueueSize, so sends never block
+	q := make(chan job, p.QueueSize)
+	for i := 0; i < workers; i++ {
+		go p.work(q)
+	}
+	p.queues[plugin] = q
+	return q
+}
+
+func (p *Pool) work(q chan job) {
+	for j := range q {
+		for {
+			j.run()
+			next, more := p.done(j)
+			if !more {
+				break
+			}
+			j = next
+		}
+	}
+}
+
+// done releases the job and returns the next one of its key
+func (p *Pool) done(j job) (job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending[j.plugin]--
+	p.wg.Done()
+	if j.key == "" {
+		return job{}, false
+	}
+
+	waiting := p.waiting[j.key]
+	if len(waiting) == 0 {
+		delete(p.waiting, j.key)
+		return job{}, false
+	}
+	p.waiting[j.key] = waiting[1:]
+	return waiting[0], true
+}
+
+// Drain stops taking jobs and waits for the pending ones up to timeout, it
+// returns how many were left behind
+func (p *Pool) Drain(timeout time.Duration) int {
+	p.mu.Lock()
+	p.draining = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	left := 0
+	for _, n := range p.pending {
+		left += n
+	}
+	if left == 0 {
+		for _, q := range p.queues {
+			close(q)
+		}
+	}
+	return left
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolSerializesKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		// overlap tells if the jobs run at the same time
+		overlap bool
+	}{
+		{
+			name: "same key runs in order",
+			keys: []string{"org/repo#1", "org/repo#1", "org/repo#1", "org/repo#1"},
+		},
+		{
+			name:    "different keys run concurrently",
+			keys:    []string{"org/repo#1", "org/repo#2", "org/repo#3", "org/repo#4"},
+			overlap: true,
+		},
+		{
+			name:    "empty keys are never serialized",
+			keys:    []string{"", "", "", ""},
+			overlap: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Pool{Workers: len(tc.keys), QueueSize: len(tc.keys)}
+
+			var (
+				lock     sync.Mutex
+				running  int
+				overlap  bool
+				order    []int
+				started  = make(chan struct{}, len(tc.keys))
+				release  = make(chan struct{})
+				finished sync.WaitGroup
+			)
+			for i, key := range tc.keys {
+				i := i
+				finished.Add(1)
+				err := p.Submit("plugin", key, func() {
+					defer finished.Done()
+					lock.Lock()
+					running++
+					if running > 1 {
+						overlap = true
+					}
+					order = append(order, i)
+					lock.Unlock()
+
+					started <- struct{}{}
+					<-release
+
+					lock.Lock()
+					running--
+					lock.Unlock()
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			// Serialized jobs start one at a time, the others all at once
+			for range tc.keys {
+				<-started
+				if !tc.overlap {
+					release <- struct{}{}
+				}
+			}
+			if tc.overlap {
+				close(release)
+			}
+			finished.Wait()
+
+			if overlap != tc.overlap {
+				t.Errorf("expected overlap %v, got %v", tc.overlap, overlap)
+			}
+			if !tc.overlap {
+				for i := range order {
+					if order[i] != i {
+						t.Errorf("expected the jobs in order, got %v", order)
+						break
+					}
+				}
+			}
+			if left := p.Drain(time.Second); left != 0 {
+				t.Errorf("expected no job left, got %v", left)
+			}
+		})
+	}
+}
+
+func TestPoolQueueSize(t *testing.T) {
+	p := &Pool{Workers: 1, QueueSize: 2}
+	release := make(chan struct{})
+	defer close(release)
+
+	for i := 0; i < 2; i++ {
+		if err := p.Submit("plugin", "", func() { <-release }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := p.Submit("plugin", "", func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected %v, got %v", ErrQueueFull, err)
+	}
+	// Every plugin has its own queue
+	if err := p.Submit("other", "", func() {}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPoolDrain(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     time.Duration
+		timeout time.Duration
+		left    int
+	}{
+		{
+			name:    "jobs finish before the timeout",
+			job:     10 * time.Millisecond,
+			timeout: time.Second,
+		},
+		{
+			name:    "jobs left after the timeout",
+			job:     time.Second,
+			timeout: 10 * time.Millisecond,
+			left:    2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Pool{Workers: 1, QueueSize: 2}
+			for i := 0; i < 2; i++ {
+				if err := p.Submit("plugin", "", func() { time.Sleep(tc.job) }); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if left := p.Drain(tc.timeout); left != tc.left {
+				t.Errorf("expected %v jobs left, got %v", tc.left, left)
+			}
+			if err := p.Submit("plugin", "", func() {}); !errors.Is(err, ErrDraining) {
+				t.Errorf("expected %v, got %v", ErrDraining, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	// maxBackoff caps the wait between two attempts of an event
+	maxBackoff = time.Hour
+)
+
+// retryable is an error worth handling the event again for
+type retryable struct {
+	err error
+}
+
+func (r retryable) Error() string {
+	return r.err.Error()
+}
+
+func (r retryable) Unwrap() error {
+	return r.err
+}
+
+// Retryable marks err as transient, the event is handled again after the
+// backoff. Handlers return it for failures that happened before any side
+// effect, other errors move the event to the dead letters right away
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryable{err: err}
+}
+
+// IsRetryable tells if err was marked with Retryable
+func IsRetryable(err error) bool {
+	var r retryable
+	return errors.As(err, &r)
+}
+
+// enqueue stores the event and queues it on the pool, events the plugin has
+// no handler for are skipped
+func (s *Server) enqueue(p Plugin, l *logrus.Entry, eventType, eventGUID string, payload []byte) error {
+	_, run, err := handler(p, l, eventType, payload)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		l.Debugf("skipping event of type %q", eventType)
+		return nil
+	}
+
+	id := eventGUID
+	if id == "" {
+		id = fmt.Sprintf("%v", time.Now().UnixNano())
+	}
+	e := Event{
+		ID:       id + "/" + p.Name(),
+		Plugin:   p.Name(),
+		Type:     eventType,
+		GUID:     eventGUID,
+		Payload:  payload,
+		Received: time.Now(),
+	}
+	// GitHub redelivers webhooks and prow may send the ones of /hook again
+	if eventGUID != "" && s.Deliveries.Seen(e.ID) {
+		l.Info("skipping duplicate delivery")
+		duplicateDeliveries.WithLabelValues(p.Name()).Inc()
+		return nil
+	}
+	if err := s.Store.Put(e); err != nil {
+		s.Deliveries.Forget(e.ID)
+		l.WithError(err).Error("failed to store event")
+		return err
+	}
+
+	// Refused events stay on the store, a full queue is retried after the
+	// backoff and a draining pool leaves them to the next start
+	err = s.submit(e)
+	if errors.Is(err, ErrQueueFull) {
+		s.retry(e, s.Backoff)
+	}
+	return err
+}
+
+// submit queues a stored event on the pool
+func (s *Server) submit(e Event) error {
+	l := s.Log.WithFields(logrus.Fields{
+		"event-type":     e.Type,
+		github.EventGUID: e.GUID,
+		"target":         e.Plugin,
+		"attempt":        e.Attempts + 1,
+	})
+
+	p := s.plugin(e.Plugin)
+	if p == nil {
+		return fmt.Errorf("plugin %q is not active", e.Plugin)
+	}
+	key, run, err := handler(p, l, e.Type, e.Payload)
+	if err != nil || run == nil {
+		return fmt.Errorf("event %v can't be handled by %v: %v", e.ID, e.Plugin, err)
+	}
+
+	return s.Pool.Submit(e.Plugin, key, func() {
+		s.handled(l, e, run())
+	})
+}
+
+// handled deletes the event once handled, retryable failures are retried with
+// exponential backoff until they run out of attempts and become dead letters
+func (s *Server) handled(l *logrus.Entry, e Event, err error) {
+	if err == nil {
+		if err := s.Store.Delete(e.ID); err != nil {
+			l.WithError(err).Error("failed to delete event")
+		}
+		return
+	}
+
+	e.Attempts++
+	e.LastError = err.Error()
+	if !IsRetryable(err) || e.Attempts >= s.MaxAttempts {
+		l.WithError(err).Error("handler failed, moving the event to the dead letters")
+		if err := s.Store.Bury(e); err != nil {
+			l.WithError(err).Error("failed to store dead letter")
+		}
+		return
+	}
+
+	delay := s.Backoff << uint(e.Attempts-1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	e.NextAttempt = time.Now().Add(delay)
+	l.WithError(err).Warnf("handler failed, retrying in %v", delay)
+	if err := s.Store.Put(e); err != nil {
+		l.WithError(err).Error("failed to store event")
+		return
+	}
+	s.retry(e, delay)
+}
+
+// retry submits the event after delay, events the pool can't take yet wait
+// for another backoff and events left when draining stay on the store
+func (s *Server) retry(e Event, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		err := s.submit(e)
+		switch {
+		case err == nil, errors.Is(err, ErrDraining):
+		case errors.Is(err, ErrQueueFull):
+			s.retry(e, s.Backoff)
+		default:
+			s.Log.WithError(err).WithField("event", e.ID).Error("failed to retry event")
+		}
+	})
+}
+
+// Resume queues the events left on the store by a previous run
+func (s *Server) Resume() error {
+	events, err := s.Store.Pending()
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		delay := time.Until(e.NextAttempt)
+		if delay < 0 {
+			delay = 0
+		}
+		s.retry(e, delay)
+	}
+	if len(events) != 0 {
+		s.Log.Infof("Resuming %v events.", len(events))
+	}
+	return nil
+}
+
+func (s *Server) plugin(name string) Plugin {
+	for _, p := range s.Plugins {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ServeAdmin registers the endpoints listing the dead letters, on
+// /dead-letters, and replaying one of them, on /dead-letters/replay?id=<id>
+func (s *Server) ServeAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("/dead-letters", s.listDeadLetters)
+	mux.HandleFunc("/dead-letters/replay", s.replayDeadLetter)
+}
+
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	events, err := s.Store.DeadLetters()
+	if err != nil {
+		s.Log.WithError(err).Error("failed to list dead letters")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Payloads are only needed to replay
+	for i := range events {
+		events[i].Payload = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		s.Log.WithError(err).Error("failed to write dead letters")
+	}
+}
+
+func (s *Server) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "replay with a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	e, err := s.Store.Revive(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	e.Attempts = 0
+	e.NextAttempt = time.Time{}
+	if err := s.Store.Put(e); err != nil {
+		s.Log.WithError(err).Error("failed to store event")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.submit(e); err != nil {
+		// The event stays pending and is resumed on the next start
+		s.Log.WithError(err).WithField("event", e.ID).Error("failed to replay event")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	s.Log.WithField("event", e.ID).Info("audit: dead letter replayed")
+	fmt.Fprintf(w, "Replaying %v.", e.ID)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandled(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		pending  bool
+		dead     bool
+	}{
+		{
+			name: "handled events are deleted",
+		},
+		{
+			name: "errors not marked retryable are buried",
+			err:  errors.New("boom"),
+			dead: true,
+		},
+		{
+			name:    "retryable errors stay pending",
+			err:     Retryable(errors.New("timeout")),
+			pending: true,
+		},
+		{
+			name:    "wrapped retryable errors stay pending",
+			err:     fmt.Errorf("sync: %w", Retryable(errors.New("timeout"))),
+			pending: true,
+		},
+		{
+			name:     "retryable errors are buried on the last attempt",
+			attempts: 2,
+			err:      Retryable(errors.New("timeout")),
+			dead:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store, _ := NewStore("")
+			// The retry never fires during the test
+			s := &Server{Store: store, MaxAttempts: 3, Backoff: time.Hour}
+			e := Event{ID: "guid/plugin", Plugin: "plugin", Attempts: tc.attempts}
+			if err := store.Put(e); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			s.handled(logrus.NewEntry(logrus.New()), e, tc.err)
+
+			pending, _ := store.Pending()
+			if (len(pending) == 1) != tc.pending {
+				t.Errorf("expected pending %v, got %v", tc.pending, pending)
+			}
+			if tc.pending && (pending[0].Attempts != tc.attempts+1 || pending[0].NextAttempt.IsZero()) {
+				t.Errorf("expected attempt %v to be scheduled, got %+v", tc.attempts+1, pending[0])
+			}
+			dead, _ := store.DeadLetters()
+			if (len(dead) == 1) != tc.dead {
+				t.Errorf("expected dead %v, got %v", tc.dead, dead)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// Server validates webhooks and dispatches them to the plugins enabled for
+// the repo of the event on plugins.yaml
+type Server struct {
+	TokenGenerator func() []byte
+	Pa             *plugins.ConfigAgent
+	Plugins        []Plugin
+	// Excluded are the org/repos each plugin skips, by plugin name
+	Excluded map[string]sets.String
+	// Pool runs the handlers, events of the same pull request or issue run
+	// one after the other
+	Pool *Pool
+	// Store keeps the events until they are handled, failed events are
+	// retried up to MaxAttempts times, waiting Backoff doubled each time
+	Store       Store
+	MaxAttempts int
+	Backoff     time.Duration
+	// Deliveries skips the deliveries a plugin already got
+	Deliveries *Deliveries
+	Log        *logrus.Entry
+}
+
+// repoEvent holds the repository every repo level event carries
+type repoEvent struct {
+	Repo github.Repo `json:"repository"`
+}
+
+// endpoint serves webhooks to the plugins returned by targets
+type endpoint struct {
+	s       *Server
+	targets func(org, repo, eventType string) []Plugin
+}
+
+// Serve registers every plugin on its own path and all of them on /hook
+func (s *Server) Serve(mux *http.ServeMux) {
+	for _, p := range s.Plugins {
+		p := p
+		mux.Handle(p.Path(), &endpoint{s: s, targets: func(org, repo, eventType string) []Plugin {
+			if !s.served(p.Name(), org, repo, eventType) {
+				return nil
+			}
+			return []Plugin{p}
+		}})
+	}
+	mux.Handle("/hook", &endpoint{s: s, targets: s.enabled})
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, e.s.TokenGenerator)
+	if !ok {
+		e.s.Log.Error("validate webhook failed")
+		return
+	}
+
+	if err := e.handleEvent(eventType, eventGUID, payload); err != nil {
+		e.s.Log.WithError(err).Error("Error parsing event.")
+		// GitHub shows the delivery as failed, stored events are still handled
+		http.Error(w, "Something went wrong", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprint(w, "Event received. Have a nice day.")
+}
+
+func (e *endpoint) handleEvent(eventType, eventGUID string, payload []byte) error {
+	var re repoEvent
+	if err := json.Unmarshal(payload, &re); err != nil {
+		return err
+	}
+
+	l := e.s.Log.WithFields(logrus.Fields{
+		"event-type":        eventType,
+		github.EventGUID:    eventGUID,
+		github.OrgLogField:  re.Repo.Owner.Login,
+		github.RepoLogField: re.Repo.Name,
+	})
+
+	targets := e.targets(re.Repo.Owner.Login, re.Repo.Name, eventType)
+	if len(targets) == 0 {
+		l.Debug("no plugin is enabled for the event, skipping")
+		return nil
+	}
+
+	var errs []string
+	for _, p := range targets {
+		if err := e.s.enqueue(p, l.WithField("target", p.Name()), eventType, eventGUID, payload); err != nil {
+			l.WithError(err).WithField("target", p.Name()).Error("failed to handle event")
+			errs = append(errs, fmt.Sprintf("%v: %v", p.Name(), err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("%v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// handler parses the payload into the typed event and returns its handler and
+// serialization key, run is nil when the plugin has no handler for the event
+func handler(p Plugin, l *logrus.Entry, eventType string, payload []byte) (key string, run func() error, err error) {
+	h := p.Handlers()
+
+	switch {
+	case eventType == "issue_comment" && h.IssueComment != nil:
+		var e github.IssueCommentEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return "", nil, err
+		}
+		key = fmt.Sprintf("%v#%v", e.Repo.FullName, e.Issue.Number)
+		run = func() error { return h.IssueComment(l, &e) }
+	case eventType == "pull_request" && h.PullRequest != nil:
+		var e github.PullRequestEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return "", nil, err
+		}
+		key = fmt.Sprintf("%v#%v", e.Repo.FullName, e.Number)
+		run = func() error { return h.PullRequest(l, &e) }
+	case eventType == "pull_request_review" && h.PullRequestReview != nil:
+		var e github.ReviewEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return "", nil, err
+		}
+		key = fmt.Sprintf("%v#%v", e.Repo.FullName, e.PullRequest.Number)
+		run = func() error { return h.PullRequestReview(l, &e) }
+	case eventType == "push" && h.Push != nil:
+		var e github.PushEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return "", nil, err
+		}
+		key = fmt.Sprintf("%v@%v", e.Repo.FullName, e.Ref)
+		run = func() error { return h.Push(l, &e) }
+	}
+	return key, run, nil
+}
+
+// enabled returns the plugins eligible for the event on org/repo
+func (s *Server) enabled(org, repo, eventType string) []Plugin {
+	var enabled []Plugin
+	for _, p := range s.Plugins {
+		if s.Eligible(p.Name(), org, repo, eventType) {
+			enabled = append(enabled, p)
+		}
+	}
+	return enabled
+}
+
+// served tells if the plugin handles the event on its own path, plugins
+// missing from plugins.yaml get every repo that is not excluded
+func (s *Server) served(name, org, repo, eventType string) bool {
+	if orgs, repos := s.Pa.Config().EnabledReposForExternalPlugin(name); orgs == nil && repos == nil {
+		return !s.excluded(name, org, repo)
+	}
+	return s.Eligible(name, org, repo, eventType)
+}
+
+// Eligible tells if the plugin handles the event on org/repo: plugins.yaml
+// has to enable it on the org or on the repo entry, for the event type when
+// the entry lists events, and the repo can't be excluded
+func (s *Server) Eligible(name, org, repo, eventType string) bool {
+	if s.excluded(name, org, repo) {
+		return false
+	}
+	fullName := org + "/" + repo
+	for key, entries := range s.Pa.Config().ExternalPlugins {
+		if !strings.EqualFold(key, org) && !strings.EqualFold(key, fullName) {
+			continue
+		}
+		if handles(entries, name, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) excluded(name, org, repo string) bool {
+	return s.Excluded[name].Has(strings.ToLower(org + "/" + repo))
+}
+
+// handles tells if the entries enable the plugin for the event, plugins
+// without events get all of them
+func handles(entries []plugins.ExternalPlugin, name, eventType string) bool {
+	for _, p := range entries {
+		if p.Name != name {
+			continue
+		}
+		if len(p.Events) == 0 {
+			return true
+		}
+		for _, e := range p.Events {
+			if e == eventType {
+				return true
+			}
+		}
+	}
+	return false
+}
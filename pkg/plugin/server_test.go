@@ -0,0 +1,110 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestEligible(t *testing.T) {
+	pa := &plugins.ConfigAgent{}
+	pa.Set(&plugins.Configuration{ExternalPlugins: map[string][]plugins.ExternalPlugin{
+		"org":        {{Name: "jira-checker"}},
+		"other/repo": {{Name: "teams", Events: []string{"pull_request"}}},
+	}})
+	s := &Server{Pa: pa, Excluded: map[string]sets.String{
+		"jira-checker": sets.NewString("org/skipped"),
+		"deploy":       sets.NewString("org/skipped"),
+	}}
+
+	tests := []struct {
+		name      string
+		plugin    string
+		org       string
+		repo      string
+		eventType string
+		eligible  bool
+		served    bool
+	}{
+		{
+			name:      "org entry enables every repo of the org",
+			plugin:    "jira-checker",
+			org:       "Org",
+			repo:      "repo",
+			eventType: "pull_request",
+			eligible:  true,
+			served:    true,
+		},
+		{
+			name:      "repo entry enables the repo",
+			plugin:    "teams",
+			org:       "other",
+			repo:      "repo",
+			eventType: "pull_request",
+			eligible:  true,
+			served:    true,
+		},
+		{
+			name:      "repo entry doesn't enable the rest of the org",
+			plugin:    "teams",
+			org:       "other",
+			repo:      "else",
+			eventType: "pull_request",
+		},
+		{
+			name:      "event type missing from the entry",
+			plugin:    "teams",
+			org:       "other",
+			repo:      "repo",
+			eventType: "issue_comment",
+		},
+		{
+			name:      "excluded repo of an enabled org",
+			plugin:    "jira-checker",
+			org:       "org",
+			repo:      "Skipped",
+			eventType: "pull_request",
+		},
+		{
+			name:      "plugin missing from plugins.yaml keeps its own path",
+			plugin:    "deploy",
+			org:       "org",
+			repo:      "repo",
+			eventType: "issue_comment",
+			served:    true,
+		},
+		{
+			name:      "plugin missing from plugins.yaml skips excluded repos",
+			plugin:    "deploy",
+			org:       "org",
+			repo:      "skipped",
+			eventType: "issue_comment",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if eligible := s.Eligible(tc.plugin, tc.org, tc.repo, tc.eventType); eligible != tc.eligible {
+				t.Errorf("expected eligible %v, got %v", tc.eligible, eligible)
+			}
+			if served := s.served(tc.plugin, tc.org, tc.repo, tc.eventType); served != tc.served {
+				t.Errorf("expected served %v, got %v", tc.served, served)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	pendingBucket = []byte("pending")
+	deadBucket    = []byte("dead")
+)
+
+// Event is a webhook kept on the Store until its plugin handles it
+type Event struct {
+	ID          string          `json:"id"`
+	Plugin      string          `json:"plugin"`
+	Type        string          `json:"type"`
+	GUID        string          `json:"guid"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Received    time.Time       `json:"received"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Store keeps the events waiting for their plugin and the dead letters, the
+// events that failed every attempt
+type Store interface {
+	// Put adds or updates a pending event
+	Put(e Event) error
+	// Delete removes a pending event
+	Delete(id string) error
+	// Pending lists the pending events, oldest first
+	Pending() ([]Event, error)
+	// Bury moves a pending event to the dead letters
+	Bury(e Event) error
+	// DeadLetters lists the dead letters, oldest first
+	DeadLetters() ([]Event, error)
+	// Revive removes a dead letter and returns it
+	Revive(id string) (Event, error)
+	Close() error
+}
+
+// NewStore opens the bolt store at path, an empty path keeps the events in
+// memory so they are lost on restart
+func NewStore(path string) (Store, error) {
+	if path == "" {
+		return &memoryStore{pending: map[string]Event{}, dead: map[string]Event{}}, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event store %v: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{pendingBucket, deadBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+type memoryStore struct {
+	lock    sync.Mutex
+	pending map[string]Event
+	dead    map[string]Event
+}
+
+func (m *memoryStore) Put(e Event) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.pending[e.ID] = e
+	return nil
+}
+
+func (m *memoryStore) Delete(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.pending, id)
+	return nil
+}
+
+func (m *memoryStore) Pending() ([]Event, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return sorted(m.pending), nil
+}
+
+func (m *memoryStore) Bury(e Event) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.pending, e.ID)
+	m.dead[e.ID] = e
+	return nil
+}
+
+func (m *memoryStore) DeadLetters() ([]Event, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return sorted(m.dead), nil
+}
+
+func (m *memoryStore) Revive(id string) (Event, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	e, found := m.dead[id]
+	if !found {
+		return Event{}, fmt.Errorf("dead letter %v not found", id)
+	}
+	delete(m.dead, id)
+	return e, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func (b *boltStore) Put(e Event) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(pendingBucket), e)
+	})
+}
+
+func (b *boltStore) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete([]byte(id))
+	})
+}
+
+func (b *boltStore) Pending() ([]Event, error) {
+	return b.list(pendingBucket)
+}
+
+func (b *boltStore) Bury(e Event) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(pendingBucket).Delete([]byte(e.ID)); err != nil {
+			return err
+		}
+		return put(tx.Bucket(deadBucket), e)
+	})
+}
+
+func (b *boltStore) DeadLetters() ([]Event, error) {
+	return b.list(deadBucket)
+}
+
+func (b *boltStore) Revive(id string) (e Event, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(deadBucket)
+		v := dead.Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("dead letter %v not found", id)
+		}
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		return dead.Delete([]byte(id))
+	})
+	return e, err
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+func (b *boltStore) list(bucket []byte) ([]Event, error) {
+	events := map[string]Event{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to parse event %s: %v", k, err)
+			}
+			events[e.ID] = e
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sorted(events), nil
+}
+
+func put(b *bolt.Bucket, e Event) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(e.ID), v)
+}
+
+func sorted(events map[string]Event) []Event {
+	list := make([]Event, 0, len(events))
+	for _, e := range events {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Received.Before(list[j].Received)
+	})
+	return list
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	unauthorizedMsg = "Sorry @%v, `/sync-teams` changes teams across the whole org, so it can only be run by the approvers of the root OWNERS file, the admin team or the org owners. Please ask one of them to run it."
+)
+
+// authorized tells how user is allowed to sync teams, it is empty when the
+// user is not allowed. A failed admin team lookup falls back to the org owners
+func (s *Server) authorized(l *logrus.Entry, org, repo, base, user string) (string, error) {
+	login := github.NormLogin(user)
+
+	owners, err := s.Oc.LoadRepoOwners(org, repo, base)
+	if err != nil {
+		return "", err
+	}
+	if owners.TopLevelApprovers().Has(login) {
+		return "root OWNERS approver", nil
+	}
+
+	if s.Config.AdminTeam != "" {
+		admin, err := s.adminTeamMember(org, login)
+		if err != nil {
+			l.WithError(err).Warnf("failed to check the %v admin team", s.Config.AdminTeam)
+		}
+		if admin {
+			return "admin team " + s.Config.AdminTeam, nil
+		}
+	}
+
+	admins, err := s.Ghc.ListOrgMembers(org, "admin")
+	if err != nil {
+		return "", err
+	}
+	if hasLogin(admins, login) {
+		return "org owner", nil
+	}
+	return "", nil
+}
+
+func (s *Server) adminTeamMember(org, login string) (bool, error) {
+	team, err := s.Ghc.GetTeamBySlug(s.Config.AdminTeam, org)
+	if err != nil {
+		return false, err
+	}
+	members, err := s.Ghc.ListTeamMembers(team.ID, github.RoleAll)
+	if err != nil {
+		return false, err
+	}
+	return hasLogin(members, login), nil
+}
+
+func hasLogin(members []github.TeamMember, login string) bool {
+	for _, m := range members {
+		if github.NormLogin(m.Login) == login {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+type fakeTeam struct {
+	id      int
+	slug    string
+	members []string
+}
+
+// fakeGithub answers the org owners and teams and keeps the comments
+type fakeGithub struct {
+	github.Client
+	admins   []string
+	teams    []fakeTeam
+	teamErr  error
+	changes  []github.PullRequestChange
+	comments []string
+}
+
+func (f *fakeGithub) GetRef(org, repo, ref string) (string, error) {
+	return "1a2b3c4", nil
+}
+
+func (f *fakeGithub) GetRepo(org, repo string) (github.FullRepo, error) {
+	return github.FullRepo{Repo: github.Repo{Owner: github.User{Login: org}, Name: repo, DefaultBranch: "master"}}, nil
+}
+
+func (f *fakeGithub) ListOrgMembers(org, role string) ([]github.TeamMember, error) {
+	return teamMembers(f.admins), nil
+}
+
+func (f *fakeGithub) GetTeamBySlug(slug, org string) (*github.Team, error) {
+	if f.teamErr != nil {
+		return nil, f.teamErr
+	}
+	for _, t := range f.teams {
+		if t.slug == slug {
+			return &github.Team{ID: t.id, Slug: t.slug}, nil
+		}
+	}
+	return nil, github.NewNotFound()
+}
+
+func (f *fakeGithub) ListTeams(org string) ([]github.Team, error) {
+	var teams []github.Team
+	for _, t := range f.teams {
+		teams = append(teams, github.Team{ID: t.id, Slug: t.slug})
+	}
+	return teams, nil
+}
+
+func (f *fakeGithub) ListTeamMembers(id int, role string) ([]github.TeamMember, error) {
+	for _, t := range f.teams {
+		if t.id == id {
+			return teamMembers(t.members), nil
+		}
+	}
+	return nil, github.NewNotFound()
+}
+
+func (f *fakeGithub) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	return f.changes, nil
+}
+
+func (f *fakeGithub) CreateComment(org, repo string, number int, body string) error {
+	f.comments = append(f.comments, body)
+	return nil
+}
+
+func teamMembers(logins []string) []github.TeamMember {
+	var members []github.TeamMember
+	for _, l := range logins {
+		members = append(members, github.TeamMember{Login: l})
+	}
+	return members
+}
+
+// newOwnersClient serves the files of each repo of org from a local git repo
+func newOwnersClient(t *testing.T, repos map[string]map[string][]byte) (git.ClientFactory, *repoowners.Client, func()) {
+	lg, gc, err := localgit.NewV2()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cleanup := func() {
+		lg.Clean()
+		gc.Clean()
+	}
+	for repo, files := range repos {
+		if err = lg.MakeFakeRepo("org", repo); err != nil {
+			cleanup()
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err = lg.AddCommit("org", repo, files); err != nil {
+			cleanup()
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	oc := repoowners.NewClient(gc, &fakeGithub{},
+		func(org, repo string) bool { return false },
+		func(org, repo string) bool { return true },
+		func() config.OwnersDirBlacklist { return config.OwnersDirBlacklist{} })
+	return gc, oc, cleanup
+}
+
+func TestAuthorized(t *testing.T) {
+	gc, oc, cleanup := newOwnersClient(t, map[string]map[string][]byte{
+		"repo": {"OWNERS": []byte("approvers:\n- root\nreviewers:\n- reviewer\n")},
+	})
+	defer cleanup()
+
+	admins := []fakeTeam{{id: 1, slug: "admins", members: []string{"alice"}}}
+
+	tests := []struct {
+		name      string
+		user      string
+		adminTeam string
+		teams     []fakeTeam
+		teamErr   error
+		via       string
+		comments  []string
+	}{
+		{
+			name:     "root OWNERS approver",
+			user:     "Root",
+			via:      "root OWNERS approver",
+			comments: []string{noChangesMsg},
+		},
+		{
+			name:      "admin team member",
+			user:      "alice",
+			adminTeam: "admins",
+			teams:     admins,
+			via:       "admin team admins",
+			comments:  []string{noChangesMsg},
+		},
+		{
+			name:      "admin team lookup error falls back to the org owners",
+			user:      "olivia",
+			adminTeam: "admins",
+			teamErr:   errors.New("boom"),
+			via:       "org owner",
+			comments:  []string{noChangesMsg},
+		},
+		{
+			name:      "missing admin team falls back to the org owners",
+			user:      "olivia",
+			adminTeam: "admins",
+			via:       "org owner",
+			comments:  []string{noChangesMsg},
+		},
+		{
+			name:     "org owner",
+			user:     "olivia",
+			via:      "org owner",
+			comments: []string{noChangesMsg},
+		},
+		{
+			name:     "admin team members need the admin team configured",
+			user:     "alice",
+			teams:    admins,
+			comments: []string{fmt.Sprintf(unauthorizedMsg, "alice")},
+		},
+		{
+			name:      "plain member is refused",
+			user:      "reviewer",
+			adminTeam: "admins",
+			teams:     admins,
+			comments:  []string{fmt.Sprintf(unauthorizedMsg, "reviewer")},
+		},
+		{
+			name:      "plain member is refused when the admin team lookup fails",
+			user:      "reviewer",
+			adminTeam: "admins",
+			teamErr:   errors.New("boom"),
+			comments:  []string{fmt.Sprintf(unauthorizedMsg, "reviewer")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ghc := &fakeGithub{admins: []string{"olivia"}, teams: tc.teams, teamErr: tc.teamErr}
+			s := &Server{Gc: gc, Oc: oc, Ghc: ghc, Config: &Config{AdminTeam: tc.adminTeam}}
+			l := logrus.NewEntry(logrus.New())
+
+			via, err := s.authorized(l, "org", "repo", "master", tc.user)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if via != tc.via {
+				t.Errorf("expected authorized by %q, got %q", tc.via, via)
+			}
+
+			pr := &github.PullRequest{Number: 1, Base: github.PullRequestBranch{Ref: "master"}}
+			if err = s.handle(l, "org", "repo", tc.user, "/sync-teams", true, pr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ghc.comments, tc.comments) {
+				t.Errorf("expected comments %q, got %q", tc.comments, ghc.comments)
+			}
+		})
+	}
+}
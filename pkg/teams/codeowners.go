@@ -0,0 +1,281 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+const (
+	CodeownersComment = "comment"
+	CodeownersCommit  = "commit"
+	CodeownersPR      = "pr"
+)
+
+var (
+	codeownersPath    = ".github/CODEOWNERS"
+	codeownersHeader  = "# Generated from the OWNERS files by prow-plugins, do not edit\n"
+	codeownersMarker  = "<!-- codeowners -->"
+	codeownersMsg     = "`%v` is out of date with the OWNERS files:\n```diff\n%v```\n" + codeownersMarker
+	codeownersTitle   = "Update CODEOWNERS from OWNERS"
+	codeownersBody    = "Regenerates `%v` from the OWNERS and OWNERS_ALIASES files."
+	codeownersBranch  = "prow-plugins/codeowners"
+	codeownersExists  = "A pull request already exists"
+	ownersFileName    = "OWNERS"
+	ownersAliasesName = "OWNERS_ALIASES"
+)
+
+// handleCodeowners checks the CODEOWNERS of the pull request head, once it is
+// merged the default branch is checked instead. The OWNERS of forks can't be
+// loaded, so their pull requests are skipped
+func (s *Server) handleCodeowners(l *logrus.Entry, org, repo string, pr *github.PullRequest) error {
+	l = l.WithField("codeowners", s.Config.Codeowners.Update)
+
+	if pr.Merged {
+		if s.Config.Codeowners.Update != CodeownersPR {
+			return nil
+		}
+		return s.codeowners(l, org, repo, pr.Base.Ref, pr.Base.Ref, func(c git.RepoClient, current, generated string) error {
+			return s.codeownersPullRequest(l, org, repo, pr.Base.Ref, c)
+		})
+	}
+
+	// Stale diffs are dropped, the file may be fixed by now
+	botName, err := s.Ghc.BotName()
+	if err != nil {
+		return err
+	}
+	err = s.Ghc.DeleteStaleComments(org, repo, pr.Number, nil, func(ic github.IssueComment) bool {
+		return github.NormLogin(botName) == github.NormLogin(ic.User.Login) && strings.Contains(ic.Body, codeownersMarker)
+	})
+	if err != nil {
+		l.WithError(err).Error("failed to prune comments")
+		return err
+	}
+
+	if pr.Head.Repo.FullName != pr.Base.Repo.FullName {
+		l.Info("skipping CODEOWNERS of a fork")
+		return nil
+	}
+	ref := pr.Head.SHA
+	if s.Config.Codeowners.Update == CodeownersCommit {
+		ref = pr.Head.Ref
+	}
+
+	return s.codeowners(l, org, repo, pr.Head.Ref, ref, func(c git.RepoClient, current, generated string) error {
+		if ref == pr.Head.Ref {
+			if err := c.Commit(codeownersTitle, fmt.Sprintf(codeownersBody, codeownersPath)); err != nil {
+				return err
+			}
+			return c.PushToCentral(pr.Head.Ref, false)
+		}
+		msg := fmt.Sprintf(codeownersMsg, codeownersPath, lineDiff(current, generated))
+		return s.Ghc.CreateComment(org, repo, pr.Number, msg)
+	})
+}
+
+// codeowners renders the CODEOWNERS of ref, with the OWNERS of its branch,
+// and when it differs from the one on the repo writes it on the clone and
+// calls outdated
+func (s *Server) codeowners(l *logrus.Entry, org, repo, branch, ref string, outdated func(c git.RepoClient, current, generated string) error) error {
+	c, err := s.Gc.ClientFor(org, repo)
+	if err != nil {
+		l.WithError(err).Error("failed to clone repo")
+		return err
+	}
+	defer func() {
+		if err := c.Clean(); err != nil {
+			l.WithError(err).Error("failed to clean repo")
+		}
+	}()
+
+	if err = c.Checkout(ref); err != nil {
+		return err
+	}
+
+	owners, err := s.Oc.LoadRepoOwners(org, repo, branch)
+	if err != nil {
+		l.WithError(err).Error("failed to load OWNERS")
+		return err
+	}
+	aliases, err := s.Oc.LoadRepoAliases(org, repo, branch)
+	if err != nil {
+		l.WithError(err).Error("failed to load OWNERS_ALIASES")
+		return err
+	}
+
+	generated, err := renderCodeowners(org, c.Directory(), owners, aliases)
+	if err != nil {
+		l.WithError(err).Error("failed to render CODEOWNERS")
+		return err
+	}
+
+	path := filepath.Join(c.Directory(), codeownersPath)
+	current, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if string(current) == generated {
+		l.Info("CODEOWNERS is up to date")
+		return nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, []byte(generated), 0644); err != nil {
+		return err
+	}
+
+	l.Info("CODEOWNERS is out of date")
+	return outdated(c, string(current), generated)
+}
+
+// codeownersPullRequest pushes the regenerated file and opens a pull request,
+// an already open one is updated by the force push
+func (s *Server) codeownersPullRequest(l *logrus.Entry, org, repo, branch string, c git.RepoClient) error {
+	if err := c.CheckoutNewBranch(codeownersBranch); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(codeownersBody, codeownersPath)
+	if err := c.Commit(codeownersTitle, body); err != nil {
+		return err
+	}
+	if err := c.PushToCentral(codeownersBranch, true); err != nil {
+		return err
+	}
+
+	number, err := s.Ghc.CreatePullRequest(org, repo, codeownersTitle, body, codeownersBranch, branch, true)
+	if err != nil && strings.Contains(err.Error(), codeownersExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	l.WithField("pr", number).Info("opened CODEOWNERS pull request")
+	return nil
+}
+
+// renderCodeowners maps the approvers of every OWNERS file under dir to a
+// CODEOWNERS rule, blacklisted directories are skipped
+func renderCodeowners(org, dir string, owners repoowners.RepoOwner, aliases repoowners.RepoAliases) (string, error) {
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != ownersFileName {
+			return nil
+		}
+		if _, err := owners.ParseSimpleConfig(path); err == filepath.SkipDir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Parents first, CODEOWNERS rules further down the file win
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := depth(dirs[i]), depth(dirs[j])
+		if di != dj {
+			return di < dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	var b strings.Builder
+	b.WriteString(codeownersHeader)
+	for _, d := range dirs {
+		// Approvers includes the parent ones unless no_parent_owners is set
+		handles := ownerHandles(org, aliases, owners.Approvers(path.Join(d, ownersFileName)))
+		if len(handles) == 0 {
+			continue
+		}
+		pattern := "*"
+		if d != "." {
+			pattern = "/" + d + "/"
+		}
+		fmt.Fprintf(&b, "%v %v\n", pattern, strings.Join(handles, " "))
+	}
+	return b.String(), nil
+}
+
+// ownerHandles folds the approvers back into the @org/alias team of every
+// alias they fully cover, the others are listed by login
+func ownerHandles(org string, aliases repoowners.RepoAliases, approvers sets.String) []string {
+	var handles []string
+	covered := sets.NewString()
+	for _, alias := range sets.StringKeySet(aliases).List() {
+		members := aliases[alias]
+		if members.Len() != 0 && approvers.IsSuperset(members) {
+			handles = append(handles, fmt.Sprintf("@%v/%v", org, alias))
+			covered = covered.Union(members)
+		}
+	}
+	for _, login := range approvers.Difference(covered).List() {
+		handles = append(handles, "@"+login)
+	}
+	sort.Strings(handles)
+	return handles
+}
+
+func depth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// lineDiff renders the lines removed from and added to a file
+func lineDiff(current, generated string) string {
+	before := sets.NewString(strings.Split(current, "\n")...)
+	after := sets.NewString(strings.Split(generated, "\n")...)
+
+	var b strings.Builder
+	for _, line := range strings.Split(current, "\n") {
+		if line != "" && !after.Has(line) {
+			fmt.Fprintf(&b, "- %v\n", line)
+		}
+	}
+	for _, line := range strings.Split(generated, "\n") {
+		if line != "" && !before.Has(line) {
+			fmt.Fprintf(&b, "+ %v\n", line)
+		}
+	}
+	return b.String()
+}
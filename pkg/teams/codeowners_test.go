@@ -0,0 +1,183 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+// fakeOwners answers the approvers of each OWNERS file and skips the
+// blacklisted directories
+type fakeOwners struct {
+	repoowners.RepoOwner
+	dir       string
+	approvers map[string]sets.String
+	blacklist sets.String
+}
+
+func (f *fakeOwners) Approvers(path string) sets.String {
+	return f.approvers[path]
+}
+
+func (f *fakeOwners) ParseSimpleConfig(path string) (repoowners.SimpleConfig, error) {
+	rel, _ := filepath.Rel(f.dir, filepath.Dir(path))
+	if f.blacklist.Has(filepath.ToSlash(rel)) {
+		return repoowners.SimpleConfig{}, filepath.SkipDir
+	}
+	return repoowners.SimpleConfig{}, nil
+}
+
+func TestRenderCodeowners(t *testing.T) {
+	aliases := repoowners.RepoAliases{
+		"backend": sets.NewString("alice", "bob"),
+		"empty":   sets.NewString(),
+	}
+
+	tests := []struct {
+		name      string
+		files     []string
+		approvers map[string]sets.String
+		blacklist sets.String
+		expected  string
+	}{
+		{
+			name:      "root only",
+			files:     []string{"OWNERS"},
+			approvers: map[string]sets.String{"OWNERS": sets.NewString("carol")},
+			expected:  "* @carol\n",
+		},
+		{
+			name:  "parents first and covered aliases become teams",
+			files: []string{"pkg/api/OWNERS", "OWNERS", "docs/OWNERS"},
+			approvers: map[string]sets.String{
+				"OWNERS":         sets.NewString("carol"),
+				"docs/OWNERS":    sets.NewString("carol", "dave"),
+				"pkg/api/OWNERS": sets.NewString("alice", "bob", "carol"),
+			},
+			expected: "* @carol\n" +
+				"/docs/ @carol @dave\n" +
+				"/pkg/api/ @carol @org/backend\n",
+		},
+		{
+			name:      "aliases only partly covered are listed by login",
+			files:     []string{"OWNERS"},
+			approvers: map[string]sets.String{"OWNERS": sets.NewString("alice")},
+			expected:  "* @alice\n",
+		},
+		{
+			name:  "directories without approvers are left out",
+			files: []string{"OWNERS", "tests/OWNERS"},
+			approvers: map[string]sets.String{
+				"OWNERS": sets.NewString("carol"),
+			},
+			expected: "* @carol\n",
+		},
+		{
+			name:  "blacklisted directories are skipped",
+			files: []string{"OWNERS", "vendor/lib/OWNERS"},
+			approvers: map[string]sets.String{
+				"OWNERS":            sets.NewString("carol"),
+				"vendor/lib/OWNERS": sets.NewString("carol", "dave"),
+			},
+			blacklist: sets.NewString("vendor/lib"),
+			expected:  "* @carol\n",
+		},
+		{
+			name:      "the git directory is skipped",
+			files:     []string{"OWNERS", ".git/OWNERS"},
+			approvers: map[string]sets.String{"OWNERS": sets.NewString("carol"), ".git/OWNERS": sets.NewString("dave")},
+			expected:  "* @carol\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "codeowners")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			for _, f := range tc.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			owners := &fakeOwners{dir: dir, approvers: tc.approvers, blacklist: tc.blacklist}
+			generated, err := renderCodeowners("org", dir, owners, aliases)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := codeownersHeader + tc.expected; generated != expected {
+				t.Errorf("expected:\n%v\ngot:\n%v", expected, generated)
+			}
+		})
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   string
+		generated string
+		expected  []string
+	}{
+		{
+			name:      "same file",
+			current:   "* @carol\n",
+			generated: "* @carol\n",
+		},
+		{
+			name:      "new file",
+			generated: "# header\n* @carol\n",
+			expected:  []string{"+ # header", "+ * @carol"},
+		},
+		{
+			name:      "changed rule",
+			current:   "* @carol\n/docs/ @dave\n",
+			generated: "* @carol\n/docs/ @carol @dave\n",
+			expected:  []string{"- /docs/ @dave", "+ /docs/ @carol @dave"},
+		},
+		{
+			name:      "reordered lines are not a change",
+			current:   "* @carol\n/docs/ @dave\n",
+			generated: "/docs/ @dave\n* @carol\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := ""
+			if len(tc.expected) != 0 {
+				expected = strings.Join(tc.expected, "\n") + "\n"
+			}
+			if diff := lineDiff(tc.current, tc.generated); diff != expected {
+				t.Errorf("expected:\n%v\ngot:\n%v", expected, diff)
+			}
+		})
+	}
+}
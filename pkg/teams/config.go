@@ -0,0 +1,133 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/dafiti-group/prow-plugins/pkg/teams/file"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the teams plugin configuration
+type Config struct {
+	// Reconcile removes the members that are not on the file instead of
+	// refusing to sync
+	Reconcile bool `yaml:"reconcile"`
+	// CreateTeams creates the teams that are declared but not on github
+	CreateTeams CreateTeams `yaml:"createTeams"`
+	// AdminTeam is the slug of the team allowed to run /sync-teams, besides
+	// the root OWNERS approvers and the org owners
+	AdminTeam string `yaml:"adminTeam"`
+	// Invite sends an org invitation to the declared members that are not on
+	// the org, they join their teams on the next sync after accepting it
+	Invite bool `yaml:"invite"`
+	// Drift periodically compares the teams of some repos with github
+	Drift Drift `yaml:"drift"`
+	// Codeowners keeps .github/CODEOWNERS in line with the OWNERS files
+	Codeowners Codeowners `yaml:"codeowners"`
+	// Offboard configures the /offboard command
+	Offboard Offboard `yaml:"offboard"`
+}
+
+// Offboard tells who can offboard users and which aliases files are cleaned
+type Offboard struct {
+	// Alias is the alias allowed to offboard, read from the OWNERS_ALIASES of
+	// AliasRepo wherever the command is commented
+	Alias string `yaml:"alias"`
+	// AliasRepo is the org/repo of the alias, a fixed repo so the aliases of
+	// any other repo can't grant the command
+	AliasRepo string `yaml:"aliasRepo"`
+	// Repos are the org/repo whose OWNERS_ALIASES are cleaned
+	Repos []string `yaml:"repos"`
+}
+
+// Codeowners tells how an outdated CODEOWNERS is reported: with a comment of
+// the diff, a commit on the pull request or a pull request once merged
+type Codeowners struct {
+	Enabled bool   `yaml:"enabled"`
+	Update  string `default:"comment" yaml:"update"`
+}
+
+// Drift lists the repos whose teams are checked in the background
+type Drift struct {
+	// Repos are org/repo names
+	Repos    []string      `yaml:"repos"`
+	Interval time.Duration `default:"1h" yaml:"interval"`
+	// Enforce applies the plan instead of opening a tracking issue
+	Enforce bool `yaml:"enforce"`
+}
+
+// CreateTeams holds the settings of the teams created by the plugin
+type CreateTeams struct {
+	Enabled     bool   `yaml:"enabled"`
+	Privacy     string `default:"closed" yaml:"privacy"`
+	Description string `default:"Managed by prow-plugins" yaml:"description"`
+	// Parent is the slug of the parent team
+	Parent string `yaml:"parent"`
+}
+
+func (c CreateTeams) defaults() file.Team {
+	return file.Team{
+		Privacy:     c.Privacy,
+		Description: c.Description,
+		Parent:      c.Parent,
+	}
+}
+
+// LoadConfig reads the teams configuration from path
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{}
+	if path == "" {
+		return c, defaults.Set(c)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	if err = defaults.Set(c); err != nil {
+		return nil, err
+	}
+
+	switch c.Codeowners.Update {
+	case CodeownersComment, CodeownersCommit, CodeownersPR:
+	default:
+		return nil, fmt.Errorf("teams config: codeowners update must be %v, %v or %v", CodeownersComment, CodeownersCommit, CodeownersPR)
+	}
+
+	for _, r := range c.Drift.Repos {
+		if len(strings.Split(r, "/")) != 2 {
+			return nil, fmt.Errorf("teams config: drift repo %q must be org/repo", r)
+		}
+	}
+	if c.Offboard.Alias != "" && len(strings.Split(c.Offboard.AliasRepo, "/")) != 2 {
+		return nil, fmt.Errorf("teams config: offboard aliasRepo %q must be org/repo", c.Offboard.AliasRepo)
+	}
+	for _, r := range c.Offboard.Repos {
+		if len(strings.Split(r, "/")) != 2 {
+			return nil, fmt.Errorf("teams config: offboard repo %q must be org/repo", r)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dafiti-group/prow-plugins/pkg/teams/file"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	driftTitle  = "GitHub teams drifted from the declared teams"
+	driftBody   = "The teams on GitHub no longer match the `%v` branch:\n%v\nUpdate the file or revert the changes on GitHub, this issue is closed once they match.\n<!-- %v -->"
+	driftMarker = "teams-drift"
+)
+
+// CheckDrift compares the declared teams of every drift repo with github
+func (s *Server) CheckDrift() {
+	for _, fullName := range s.Config.Drift.Repos {
+		parts := strings.Split(fullName, "/")
+		l := s.Log.WithFields(logrus.Fields{
+			github.OrgLogField:  parts[0],
+			github.RepoLogField: parts[1],
+		})
+		if err := s.checkDrift(l, parts[0], parts[1]); err != nil {
+			l.WithError(err).Error("failed to check teams drift")
+		}
+	}
+}
+
+func (s *Server) checkDrift(l *logrus.Entry, org, repo string) error {
+	r, err := s.Ghc.GetRepo(org, repo)
+	if err != nil {
+		l.WithError(err).Error("failed to get repo")
+		return err
+	}
+
+	file := file.New(l, s.Ghc, s.Gc, s.Oc, org)
+	if s.Config.CreateTeams.Enabled {
+		file.EnableCreate(s.Config.CreateTeams.defaults())
+	}
+	if s.Config.Invite {
+		file.EnableInvite()
+	}
+	if err = file.Clone(repo, r.DefaultBranch); err != nil {
+		return err
+	}
+	if err = file.Fetch(); err != nil {
+		return err
+	}
+
+	var drift []string
+	if len(file.NotAdmin) != 0 {
+		drift = append(drift, fmt.Sprintf(notAdminMsg, strings.Join(file.NotAdmin, "`, `")))
+	}
+	if len(file.Missing) != 0 {
+		drift = append(drift, fmt.Sprintf(missingMsg, strings.Join(file.Missing, "`, `")))
+	}
+	if !file.Plan.Empty() {
+		drift = append(drift, file.Plan.String())
+	}
+
+	// Removals are only enforced when the plugin reconciles
+	removals := file.Plan.Removals()
+	if len(drift) != 0 && s.Config.Drift.Enforce && len(file.Missing) == 0 && len(file.NotAdmin) == 0 && (len(removals) == 0 || s.Config.Reconcile) {
+		l.WithField("plan", file.Plan.String()).Warn("enforcing teams drift")
+		if err = file.Sync(); err != nil {
+			l.WithError(err).Error("failed to enforce teams")
+			return err
+		}
+		drift = nil
+	}
+
+	return s.trackDrift(l, org, repo, r.DefaultBranch, drift)
+}
+
+// trackDrift opens or updates the drift issue, or closes it when there is no drift
+func (s *Server) trackDrift(l *logrus.Entry, org, repo, branch string, drift []string) error {
+	botName, err := s.Ghc.BotName()
+	if err != nil {
+		return err
+	}
+
+	issues, err := s.Ghc.ListOpenIssues(org, repo)
+	if err != nil {
+		l.WithError(err).Error("failed to list issues")
+		return err
+	}
+
+	var issue *github.Issue
+	for i, is := range issues {
+		if !is.IsPullRequest() && github.NormLogin(is.User.Login) == github.NormLogin(botName) && strings.Contains(is.Body, driftMarker) {
+			issue = &issues[i]
+			break
+		}
+	}
+
+	if len(drift) == 0 {
+		if issue == nil {
+			return nil
+		}
+		l.WithField("issue", issue.Number).Info("teams drift is gone, closing issue")
+		return s.Ghc.CloseIssue(org, repo, issue.Number)
+	}
+
+	body := fmt.Sprintf(driftBody, branch, strings.Join(drift, "\n"), driftMarker)
+	if issue == nil {
+		number, err := s.Ghc.CreateIssue(org, repo, driftTitle, body, 0, nil, nil)
+		if err != nil {
+			return err
+		}
+		l.WithField("issue", number).Warn("teams drift detected")
+		return nil
+	}
+
+	if issue.Body == body {
+		return nil
+	}
+	_, err = s.Ghc.EditIssue(org, repo, issue.Number, &github.Issue{Body: body})
+	return err
+}
@@ -2,37 +2,71 @@ package file
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/creasty/defaults"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 	"k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/repoowners"
 )
 
 type Base struct {
-	ApiVersion string `yaml:"apiVersion"`
+	ApiVersion string `default:"v1" yaml:"apiVersion"`
 	Teams      []Team `yaml:"teams"`
-	log        *logrus.Entry
-	ghc        github.Client
-	gc         git.ClientFactory
-	oc         *repoowners.Client
-	org        string
+	Plan       Plan   `yaml:"-"`
+	// Missing are the teams that are not on github and won't be created
+	Missing []string `yaml:"-"`
+	// NotAdmin are the orgs of the file the bot is not an admin of
+	NotAdmin []string `yaml:"-"`
+	// Created are the teams created by Sync
+	Created []string `yaml:"-"`
+	// Results are the outcome of each change applied by Sync
+	Results  []Result `yaml:"-"`
+	log      *logrus.Entry
+	ghc      github.Client
+	gc       git.ClientFactory
+	oc       *repoowners.Client
+	org      string
+	defaults *Team
+	invite   bool
 }
 
 type Team struct {
-	ID      int      `yaml:"id"`
-	Name    string   `yaml:"name"`
-	Members []Member `yaml:"members"`
+	ID int `yaml:"id"`
+	// Org is where the team lives, the org of the repo when empty
+	Org         string   `yaml:"org"`
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Privacy     string   `yaml:"privacy"`
+	Parent      string   `yaml:"parent"`
+	Members     []Member `yaml:"members"`
+	// Repos are only reconciled when declared, an empty list revokes every repo
+	Repos []Repo `yaml:"repos"`
+	// roles tells if the members roles are declared and should be reconciled
+	roles bool
 }
 
 type Member struct {
-	Login      string `yaml:"login"`
-	Maintainer bool   `default:"true" yaml:"maintainer"`
+	Login string `yaml:"login"`
+	// Maintainer has no default, a true default would make false impossible
+	Maintainer bool `yaml:"maintainer"`
 }
 
+const (
+	// ApiVersion is the TEAMS file version this package reads
+	ApiVersion = "v1"
+)
+
 var (
-	fileName = "OWNERS_ALIASES"
+	fileName        = "TEAMS"
+	aliasesFileName = "OWNERS_ALIASES"
 )
 
 func New(l *logrus.Entry, ghc github.Client, gc git.ClientFactory, oc *repoowners.Client, org string) *Base {
@@ -45,8 +79,70 @@ func New(l *logrus.Entry, ghc github.Client, gc git.ClientFactory, oc *repoowner
 	}
 }
 
+// Clone reads the TEAMS file of the repo at commit, falling back to the
+// OWNERS_ALIASES when the repo has none
 func (s *Base) Clone(repo, commit string) (err error) {
+	c, err := s.gc.ClientFor(s.org, repo)
+	if err != nil {
+		s.log.WithError(err).Error("failed to clone repo")
+		return err
+	}
+	defer func() {
+		if err := c.Clean(); err != nil {
+			s.log.WithError(err).Error("failed to clean repo")
+		}
+	}()
+
+	if err = c.Checkout(commit); err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(c.Directory(), fileName))
+	if os.IsNotExist(err) {
+		s.log.Infof("%v not found, using %v", fileName, aliasesFileName)
+		return s.loadAliases(repo, commit)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.load(b)
+}
+
+// load parses a TEAMS file, every member role on it is reconciled
+func (s *Base) load(b []byte) (err error) {
+	if err = yaml.Unmarshal(b, s); err != nil {
+		return fmt.Errorf("failed to parse %v: %v", fileName, err)
+	}
+
+	if err = defaults.Set(s); err != nil {
+		return err
+	}
+
+	if s.ApiVersion != ApiVersion {
+		return fmt.Errorf("%v apiVersion %q is not supported, use %q", fileName, s.ApiVersion, ApiVersion)
+	}
+
+	for i := range s.Teams {
+		if s.Teams[i].Name == "" {
+			return fmt.Errorf("%v has a team without name", fileName)
+		}
+		if err = validateRepos(s.Teams[i]); err != nil {
+			return fmt.Errorf("%v: %v", fileName, err)
+		}
+		s.Teams[i].roles = true
+	}
+	return nil
+}
+
+// loadAliases builds the teams from OWNERS_ALIASES, where there are no roles
+func (s *Base) loadAliases(repo, commit string) (err error) {
 	ra, err := s.oc.LoadRepoAliases(s.org, repo, commit)
+	if err != nil {
+		s.log.WithError(err).Errorf("failed to load %v", aliasesFileName)
+		return err
+	}
+
 	for teamName, members := range ra {
 		team := Team{
 			Name: teamName,
@@ -59,71 +155,359 @@ func (s *Base) Clone(repo, commit string) (err error) {
 		s.Teams = append(s.Teams, team)
 	}
 
+	sort.Slice(s.Teams, func(i, j int) bool {
+		return s.Teams[i].Name < s.Teams[j].Name
+	})
 	return nil
 }
 
-//
-func (s *Base) Sync() (err error) {
-	for _, team := range s.Teams {
-		for _, member := range team.Members {
-			if _, err = s.ghc.UpdateTeamMembership(team.ID, member.Login, member.Maintainer); err != nil {
-				s.log.WithError(err).Error("failed to sync")
-				return err
-			}
+// EnableCreate makes Fetch plan the creation of the teams missing on github,
+// the settings a team does not declare are taken from defaults
+func (s *Base) EnableCreate(defaults Team) {
+	s.defaults = &defaults
+}
+
+// Sync applies the plan computed by Fetch. Every change is attempted, the
+// outcome of each one is kept on Results
+func (s *Base) Sync() error {
+	s.Results = nil
+	created := map[string]int{}
+	failed := 0
+	for _, c := range s.Plan.Changes {
+		l := s.log.WithFields(logrus.Fields{"org": c.Org, "team": c.Team, "login": c.Login, "repo": c.Repo, "action": c.Action})
+
+		// Members of created teams only get an ID once the team exists
+		id := c.TeamID
+		if id == 0 {
+			id = created[teamKey(c.Org, c.Team)]
 		}
+
+		r := Result{Change: c}
+		if id == 0 && c.Action != ActionCreate && c.Action != ActionInvite {
+			r.Err = fmt.Errorf("team %v was not created", c.Team)
+		} else {
+			r.Attempts, r.Err = retry(func() error {
+				return s.apply(id, c, created)
+			})
+		}
+		s.Results = append(s.Results, r)
+
+		if r.Err != nil {
+			failed++
+			l.WithError(r.Err).WithField("attempts", r.Attempts).Error("failed to sync")
+			continue
+		}
+		l.Info("synced")
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%v of %v changes failed", failed, len(s.Plan.Changes))
 	}
 	return nil
 }
 
+// apply runs a single change on github
+func (s *Base) apply(id int, c Change, created map[string]int) (err error) {
+	switch {
+	case c.Repo != "":
+		err = s.syncRepo(id, c)
+	case c.Action == ActionCreate:
+		var t *github.Team
+		if t, err = s.createTeam(*c.NewTeam); err == nil {
+			created[teamKey(c.Org, c.Team)] = t.ID
+			s.Created = append(s.Created, s.displayName(c.Org, t.Slug))
+		}
+	case c.Action == ActionEdit:
+		err = s.editTeam(id, *c.NewTeam)
+	case c.Action == ActionAdd, c.Action == ActionUpdate:
+		_, err = s.ghc.UpdateTeamMembership(id, c.Login, c.Maintainer)
+	case c.Action == ActionRemove:
+		err = s.ghc.RemoveTeamMembership(id, c.Login)
+	case c.Action == ActionInvite:
+		_, err = s.ghc.UpdateOrgMembership(c.Org, c.Login, false)
+	}
+	return err
+}
+
+// Fetch compares the file with github and computes the plan
 func (s *Base) Fetch() (err error) {
-	diffMembersList := make(map[string][]string)
+	s.Plan = Plan{}
+	s.Missing = nil
+	s.NotAdmin = nil
+
+	for i := range s.Teams {
+		if s.Teams[i].Org == "" {
+			s.Teams[i].Org = s.org
+		}
+	}
+
+	// Teams of other orgs are only synced when the bot can manage them
+	if err = s.checkAdmin(); err != nil || len(s.NotAdmin) != 0 {
+		return err
+	}
 
 	for key, team := range s.Teams {
 		//
-		t, err := s.ghc.GetTeamBySlug(team.Name, s.org)
+		t, err := s.ghc.GetTeamBySlug(team.Name, team.Org)
+		if github.IsNotFound(err) {
+			s.planCreate(team)
+			continue
+		}
 		if err != nil {
 			s.log.WithError(err).Errorf("team %v not found", team.Name)
 			return err
 		}
 
 		//
-		actualMembers, err := s.ghc.ListTeamMembers(t.ID, "")
+		actualMembers, err := s.ghc.ListTeamMembers(t.ID, github.RoleAll)
 		if err != nil {
 			s.log.WithError(err).Error("failed geting team members")
 			return err
 		}
 
+		//
+		maintainers, err := s.ghc.ListTeamMembers(t.ID, github.RoleMaintainer)
+		if err != nil {
+			s.log.WithError(err).Error("failed geting team maintainers")
+			return err
+		}
+
 		// Update team ID
 		s.Teams[key].ID = t.ID
 
+		// Settings are only managed by the TEAMS file
+		if team.roles {
+			if change := settingsDiff(s.Teams[key], t); change != nil {
+				s.Plan.Changes = append(s.Plan.Changes, *change)
+			}
+		}
+
 		//
-		diff := diff(actualMembers, team.Members)
-		if len(diff) != 0 {
-			diffMembersList[t.Slug] = diff
+		s.Plan.Changes = append(s.Plan.Changes, diff(s.Teams[key], actualMembers, maintainers)...)
+
+		// Repos are only managed when the TEAMS file declares them
+		if team.roles && team.Repos != nil {
+			repos, err := s.teamRepos(team.Org, t.Slug)
+			if err != nil {
+				s.log.WithError(err).Error("failed geting team repos")
+				return err
+			}
+			s.Plan.Changes = append(s.Plan.Changes, reposDiff(s.Teams[key], repos)...)
 		}
 	}
 
-	//
-	if len(diffMembersList) != 0 {
-		err = fmt.Errorf("%v", diffMembersList)
-		return err
+	return s.validateMembers()
+}
+
+// planCreate plans the creation of a team that is not on github, or marks it
+// as missing when creation is not enabled
+func (s *Base) planCreate(team Team) {
+	if s.defaults == nil {
+		s.Missing = append(s.Missing, s.displayName(team.Org, team.Name))
+		return
 	}
 
-	return nil
+	if team.Description == "" {
+		team.Description = s.defaults.Description
+	}
+	if team.Privacy == "" {
+		team.Privacy = s.defaults.Privacy
+	}
+	if team.Parent == "" {
+		team.Parent = s.defaults.Parent
+	}
+
+	s.Plan.Changes = append(s.Plan.Changes, Change{Org: team.Org, Team: team.Name, Action: ActionCreate, NewTeam: &team})
+	s.Plan.Changes = append(s.Plan.Changes, diff(team, nil, nil)...)
+	s.Plan.Changes = append(s.Plan.Changes, reposDiff(team, nil)...)
+}
+
+// settingsDiff returns an edit when the declared settings differ from github
+func settingsDiff(team Team, t *github.Team) *Change {
+	var diffs []string
+	if team.Description != "" && team.Description != t.Description {
+		diffs = append(diffs, fmt.Sprintf("description: %q -> %q", t.Description, team.Description))
+	}
+	if team.Privacy != "" && team.Privacy != t.Privacy {
+		diffs = append(diffs, fmt.Sprintf("privacy: %v -> %v", t.Privacy, team.Privacy))
+	}
+	parent := ""
+	if t.Parent != nil {
+		parent = t.Parent.Slug
+	}
+	if team.Parent != "" && !strings.EqualFold(team.Parent, parent) {
+		diffs = append(diffs, fmt.Sprintf("parent: %q -> %q", parent, team.Parent))
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+	return &Change{Org: team.Org, TeamID: t.ID, Team: team.Name, Action: ActionEdit, NewTeam: &team, Diff: diffs}
+}
+
+func (s *Base) editTeam(id int, team Team) error {
+	t := github.Team{
+		ID:          id,
+		Name:        team.Name,
+		Description: team.Description,
+		Privacy:     team.Privacy,
+	}
+
+	if team.Parent != "" {
+		parent, err := s.ghc.GetTeamBySlug(team.Parent, team.Org)
+		if err != nil {
+			return err
+		}
+		t.ParentTeamID = &parent.ID
+	}
+
+	_, err := s.ghc.EditTeam(t)
+	return err
 }
 
-//
-func diff(currentUsers []github.TeamMember, fileUsers []Member) []string {
-	mb := make(map[string]struct{}, len(fileUsers))
-	for _, x := range fileUsers {
-		mb[strings.ToLower(x.Login)] = struct{}{}
+func (s *Base) createTeam(team Team) (*github.Team, error) {
+	t := github.Team{
+		Name:        team.Name,
+		Description: team.Description,
+		Privacy:     team.Privacy,
+	}
+
+	if team.Parent != "" {
+		parent, err := s.ghc.GetTeamBySlug(team.Parent, team.Org)
+		if err != nil {
+			return nil, err
+		}
+		t.ParentTeamID = &parent.ID
+	}
+
+	return s.ghc.CreateTeam(team.Org, t)
+}
+
+// diff returns the changes that make the github team match the file team
+func diff(team Team, currentUsers, maintainers []github.TeamMember) []Change {
+	current := make(map[string]bool, len(currentUsers))
+	for _, x := range currentUsers {
+		current[strings.ToLower(x.Login)] = false
+	}
+	for _, x := range maintainers {
+		current[strings.ToLower(x.Login)] = true
+	}
+
+	var changes []Change
+	declared := make(map[string]struct{}, len(team.Members))
+	for _, x := range team.Members {
+		login := strings.ToLower(x.Login)
+		declared[login] = struct{}{}
+
+		maintainer, found := current[login]
+		switch {
+		case !found:
+			changes = append(changes, Change{Org: team.Org, TeamID: team.ID, Team: team.Name, Login: x.Login, Action: ActionAdd, Maintainer: x.Maintainer})
+		case team.roles && maintainer != x.Maintainer:
+			changes = append(changes, Change{Org: team.Org, TeamID: team.ID, Team: team.Name, Login: x.Login, Action: ActionUpdate, Maintainer: x.Maintainer, WasMaintainer: maintainer})
+		}
 	}
 
-	var diff []string
 	for _, x := range currentUsers {
-		if _, found := mb[strings.ToLower(x.Login)]; !found {
-			diff = append(diff, x.Login)
+		if _, found := declared[strings.ToLower(x.Login)]; !found {
+			changes = append(changes, Change{Org: team.Org, TeamID: team.ID, Team: team.Name, Login: x.Login, Action: ActionRemove, WasMaintainer: current[strings.ToLower(x.Login)]})
 		}
 	}
-	return diff
+	return changes
+}
+
+// Managed tells if path is a file the teams are read from
+func Managed(path string) bool {
+	return path == fileName || path == aliasesFileName
+}
+
+// ChangedTeams returns the teams that are new or declared differently than
+// on previous, removed teams are no longer managed and are left out
+func (s *Base) ChangedTeams(previous *Base) []string {
+	before := make(map[string]Team, len(previous.Teams))
+	for _, t := range previous.Teams {
+		before[previous.key(t)] = t
+	}
+
+	var changed []string
+	for _, t := range s.Teams {
+		if b, found := before[s.key(t)]; !found || !reflect.DeepEqual(b, t) {
+			changed = append(changed, s.key(t))
+		}
+	}
+	return changed
+}
+
+// Filter keeps only the teams returned by ChangedTeams
+func (s *Base) Filter(keys []string) {
+	keep := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keep[key] = true
+	}
+
+	teams := s.Teams[:0]
+	for _, t := range s.Teams {
+		if keep[s.key(t)] {
+			teams = append(teams, t)
+		}
+	}
+	s.Teams = teams
+}
+
+// key identifies a team across orgs
+func (s *Base) key(t Team) string {
+	org := t.Org
+	if org == "" {
+		org = s.org
+	}
+	return teamKey(org, t.Name)
+}
+
+func teamKey(org, name string) string {
+	return strings.ToLower(org + "/" + name)
+}
+
+// displayName prefixes the team with its org when it is not the repo org
+func (s *Base) displayName(org, name string) string {
+	if strings.EqualFold(org, s.org) {
+		return name
+	}
+	return org + "/" + name
+}
+
+// checkAdmin lists on NotAdmin the orgs of the teams where the bot is not an owner
+func (s *Base) checkAdmin() error {
+	orgs := map[string]bool{}
+	for _, t := range s.Teams {
+		orgs[strings.ToLower(t.Org)] = true
+	}
+	if len(orgs) == 1 && orgs[strings.ToLower(s.org)] {
+		return nil
+	}
+
+	botName, err := s.ghc.BotName()
+	if err != nil {
+		return err
+	}
+
+	for org := range orgs {
+		admins, err := s.ghc.ListOrgMembers(org, "admin")
+		if err != nil {
+			s.log.WithError(err).Errorf("failed to list %v admins", org)
+			return err
+		}
+
+		admin := false
+		for _, a := range admins {
+			if github.NormLogin(a.Login) == github.NormLogin(botName) {
+				admin = true
+				break
+			}
+		}
+		if !admin {
+			s.NotAdmin = append(s.NotAdmin, org)
+		}
+	}
+	sort.Strings(s.NotAdmin)
+	return nil
 }
@@ -0,0 +1,373 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/repoowners"
+)
+
+func TestDiff(t *testing.T) {
+	members := func(logins ...string) []github.TeamMember {
+		var m []github.TeamMember
+		for _, l := range logins {
+			m = append(m, github.TeamMember{Login: l})
+		}
+		return m
+	}
+	change := func(login string, action Action, maintainer, was bool) Change {
+		return Change{Org: "org", TeamID: 1, Team: "team", Login: login, Action: action, Maintainer: maintainer, WasMaintainer: was}
+	}
+
+	tests := []struct {
+		name        string
+		team        Team
+		current     []github.TeamMember
+		maintainers []github.TeamMember
+		expected    []Change
+	}{
+		{
+			name:    "up to date",
+			team:    Team{Members: []Member{{Login: "alice"}}},
+			current: members("alice"),
+		},
+		{
+			name:     "declared members are added",
+			team:     Team{Members: []Member{{Login: "alice"}, {Login: "bob", Maintainer: true}}},
+			current:  members("alice"),
+			expected: []Change{change("bob", ActionAdd, true, false)},
+		},
+		{
+			name:        "undeclared members are removed with their role",
+			team:        Team{Members: []Member{{Login: "alice"}}},
+			current:     members("alice", "bob"),
+			maintainers: members("bob"),
+			expected:    []Change{change("bob", ActionRemove, false, true)},
+		},
+		{
+			name:    "logins are case insensitive",
+			team:    Team{Members: []Member{{Login: "Alice"}}},
+			current: members("alice"),
+		},
+		{
+			name:        "roles are only reconciled when declared",
+			team:        Team{Members: []Member{{Login: "alice"}}},
+			current:     members("alice"),
+			maintainers: members("alice"),
+		},
+		{
+			name:        "declared roles are reconciled",
+			team:        Team{Members: []Member{{Login: "alice"}, {Login: "bob", Maintainer: true}}, roles: true},
+			current:     members("alice", "bob"),
+			maintainers: members("alice"),
+			expected: []Change{
+				change("alice", ActionUpdate, false, true),
+				change("bob", ActionUpdate, true, false),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.team.Org, tc.team.ID, tc.team.Name = "org", 1, "team"
+			if changes := diff(tc.team, tc.current, tc.maintainers); !reflect.DeepEqual(changes, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, changes)
+			}
+		})
+	}
+}
+
+// fakeGithub answers the calls the teams make to github
+type fakeGithub struct {
+	github.Client
+	// admins, members and invited are the logins of each org
+	admins  map[string][]string
+	members map[string][]string
+	invited map[string][]string
+	// users are the logins that exist on github
+	users sets.String
+	// teams are the team IDs by org/slug, and teamMembers their members
+	teams       map[string]int
+	teamMembers map[int][]string
+}
+
+func (f *fakeGithub) BotName() (string, error) {
+	return "bot", nil
+}
+
+func (f *fakeGithub) ListOrgMembers(org, role string) ([]github.TeamMember, error) {
+	logins := f.members[org]
+	if role == "admin" {
+		logins = f.admins[org]
+	}
+	var members []github.TeamMember
+	for _, login := range logins {
+		members = append(members, github.TeamMember{Login: login})
+	}
+	return members, nil
+}
+
+func (f *fakeGithub) GetTeamBySlug(slug, org string) (*github.Team, error) {
+	id, found := f.teams[org+"/"+slug]
+	if !found {
+		return nil, github.NewNotFound()
+	}
+	return &github.Team{ID: id, Slug: slug, Name: slug}, nil
+}
+
+func (f *fakeGithub) ListTeamMembers(id int, role string) ([]github.TeamMember, error) {
+	var members []github.TeamMember
+	if role == github.RoleAll {
+		for _, login := range f.teamMembers[id] {
+			members = append(members, github.TeamMember{Login: login})
+		}
+	}
+	return members, nil
+}
+
+func (f *fakeGithub) ListOrgInvitations(org string) ([]github.OrgInvitation, error) {
+	var invitations []github.OrgInvitation
+	for _, login := range f.invited[org] {
+		invitations = append(invitations, github.OrgInvitation{TeamMember: github.TeamMember{Login: login}})
+	}
+	return invitations, nil
+}
+
+func (f *fakeGithub) Query(ctx context.Context, q interface{}, vars map[string]interface{}) error {
+	login := string(vars["login"].(githubql.String))
+	if !f.users.Has(login) {
+		return fmt.Errorf("Could not resolve to a User with the login of '%v'.", login)
+	}
+	q.(*userQuery).User.Login = githubql.String(login)
+	return nil
+}
+
+func (f *fakeGithub) GetRef(org, repo, ref string) (string, error) {
+	return "1a2b3c4", nil
+}
+
+func TestClone(t *testing.T) {
+	aliases := "aliases:\n  frontend:\n  - bob\n"
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []Team
+		wantErr  bool
+	}{
+		{
+			name: "TEAMS is read over OWNERS_ALIASES",
+			files: map[string]string{
+				fileName:        "teams:\n- name: backend\n  members:\n  - login: alice\n    maintainer: true\n",
+				aliasesFileName: aliases,
+			},
+			expected: []Team{{Name: "backend", Members: []Member{{Login: "alice", Maintainer: true}}, roles: true}},
+		},
+		{
+			name:     "OWNERS_ALIASES without TEAMS",
+			files:    map[string]string{aliasesFileName: aliases},
+			expected: []Team{{Name: "frontend", Members: []Member{{Login: "bob"}}}},
+		},
+		{
+			name:     "declared apiVersion",
+			files:    map[string]string{fileName: "apiVersion: v1\nteams:\n- name: backend\n"},
+			expected: []Team{{Name: "backend", roles: true}},
+		},
+		{
+			name:    "unknown apiVersion",
+			files:   map[string]string{fileName: "apiVersion: v2\nteams:\n- name: backend\n", aliasesFileName: aliases},
+			wantErr: true,
+		},
+		{
+			name:    "team without name",
+			files:   map[string]string{fileName: "teams:\n- members:\n  - login: alice\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lg, gc, err := localgit.NewV2()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() {
+				lg.Clean()
+				gc.Clean()
+			}()
+
+			if err = lg.MakeFakeRepo("org", "repo"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			files := map[string][]byte{}
+			for name, content := range tc.files {
+				files[name] = []byte(content)
+			}
+			if err = lg.AddCommit("org", "repo", files); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sha, err := lg.RevParse("org", "repo", "HEAD")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			oc := repoowners.NewClient(gc, &fakeGithub{},
+				func(org, repo string) bool { return false },
+				func(org, repo string) bool { return false },
+				func() config.OwnersDirBlacklist { return config.OwnersDirBlacklist{} })
+			b := New(logrus.NewEntry(logrus.New()), nil, gc, oc, "org")
+
+			err = b.Clone("repo", sha)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(b.Teams, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, b.Teams)
+			}
+		})
+	}
+}
+
+func TestChangedTeams(t *testing.T) {
+	team := func(org, name string, logins ...string) Team {
+		team := Team{Org: org, Name: name, roles: true}
+		for _, l := range logins {
+			team.Members = append(team.Members, Member{Login: l})
+		}
+		return team
+	}
+
+	tests := []struct {
+		name     string
+		previous []Team
+		current  []Team
+		expected []string
+	}{
+		{
+			name:     "unchanged teams are filtered out",
+			previous: []Team{team("", "backend", "alice"), team("", "frontend", "bob")},
+			current:  []Team{team("", "backend", "alice"), team("", "frontend", "bob", "carol")},
+			expected: []string{"org/frontend"},
+		},
+		{
+			name:     "new teams",
+			previous: []Team{team("", "backend", "alice")},
+			current:  []Team{team("", "backend", "alice"), team("", "frontend", "bob")},
+			expected: []string{"org/frontend"},
+		},
+		{
+			name:     "renamed team is synced under its new name",
+			previous: []Team{team("", "backend", "alice")},
+			current:  []Team{team("", "platform", "alice")},
+			expected: []string{"org/platform"},
+		},
+		{
+			name:     "removed teams are left alone",
+			previous: []Team{team("", "backend", "alice"), team("", "frontend", "bob")},
+			current:  []Team{team("", "backend", "alice")},
+		},
+		{
+			name:     "the repo org is the default org",
+			previous: []Team{team("", "backend", "alice")},
+			current:  []Team{team("org", "backend", "alice"), team("org-b", "backend", "alice")},
+			expected: []string{"org/backend", "org-b/backend"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			previous := &Base{org: "org", Teams: tc.previous}
+			current := &Base{org: "org", Teams: tc.current}
+
+			changed := current.ChangedTeams(previous)
+			if !reflect.DeepEqual(changed, tc.expected) {
+				t.Fatalf("expected changed %v, got %v", tc.expected, changed)
+			}
+
+			current.Filter(changed)
+			var kept []string
+			for _, team := range current.Teams {
+				kept = append(kept, current.key(team))
+			}
+			if !reflect.DeepEqual(kept, tc.expected) {
+				t.Errorf("expected kept %v, got %v", tc.expected, kept)
+			}
+		})
+	}
+}
+
+func TestFetchOrgs(t *testing.T) {
+	teams := []Team{
+		{Name: "backend", Members: []Member{{Login: "alice"}}, roles: true},
+		{Org: "org-b", Name: "infra", Members: []Member{{Login: "bob"}}, roles: true},
+	}
+
+	tests := []struct {
+		name     string
+		teams    []Team
+		admins   map[string][]string
+		notAdmin []string
+		expected []Change
+		orgs     []string
+	}{
+		{
+			name:   "teams are planned on their own org",
+			teams:  teams,
+			admins: map[string][]string{"org": {"bot"}, "org-b": {"Bot"}},
+			orgs:   []string{"org", "org-b"},
+			expected: []Change{
+				{Org: "org", TeamID: 1, Team: "backend", Login: "alice", Action: ActionAdd},
+				{Org: "org-b", TeamID: 2, Team: "infra", Login: "bob", Action: ActionAdd},
+			},
+		},
+		{
+			name:     "bot not owner of one org syncs nothing",
+			teams:    teams,
+			admins:   map[string][]string{"org": {"bot"}, "org-b": {"alice"}},
+			notAdmin: []string{"org-b"},
+		},
+		{
+			name:  "teams of the repo org only don't need the bot to be an owner",
+			teams: teams[:1],
+			orgs:  []string{"org"},
+			expected: []Change{
+				{Org: "org", TeamID: 1, Team: "backend", Login: "alice", Action: ActionAdd},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ghc := &fakeGithub{
+				admins:      tc.admins,
+				members:     map[string][]string{"org": {"alice"}, "org-b": {"bob"}},
+				users:       sets.NewString("alice", "bob"),
+				teams:       map[string]int{"org/backend": 1, "org-b/infra": 2},
+				teamMembers: map[int][]string{},
+			}
+			b := New(logrus.NewEntry(logrus.New()), ghc, nil, nil, "org")
+			b.Teams = append([]Team(nil), tc.teams...)
+
+			if err := b.Fetch(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(b.NotAdmin, tc.notAdmin) {
+				t.Errorf("expected not admin %v, got %v", tc.notAdmin, b.NotAdmin)
+			}
+			if !reflect.DeepEqual(b.Plan.Changes, tc.expected) {
+				t.Errorf("expected changes %+v, got %+v", tc.expected, b.Plan.Changes)
+			}
+			if orgs := b.Plan.Orgs(); !reflect.DeepEqual(orgs, tc.orgs) {
+				t.Errorf("expected plan orgs %v, got %v", tc.orgs, orgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package file
+
+import (
+	"context"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+)
+
+// Reasons a declared member is not added to its team
+const (
+	ReasonUnknown   = "user not found, check for typos"
+	ReasonNotMember = "not an org member, invite them or enable `invite`"
+	ReasonInvited   = "invited to the org, added once the invitation is accepted"
+)
+
+// Skip is a declared member left out of the plan
+type Skip struct {
+	Team   string
+	Login  string
+	Reason string
+}
+
+type userQuery struct {
+	User struct {
+		Login githubql.String
+	} `graphql:"user(login: $login)"`
+}
+
+// EnableInvite makes Fetch plan an org invitation for the declared members
+// that are not on the org
+func (s *Base) EnableInvite() {
+	s.invite = true
+}
+
+// validateMembers drops the additions github would refuse, members must be on
+// the org before joining a team. They are reported as skipped and, when
+// invites are enabled, invited to the org
+func (s *Base) validateMembers() error {
+	var adds []Change
+	for _, c := range s.Plan.Changes {
+		if c.Action == ActionAdd {
+			adds = append(adds, c)
+		}
+	}
+	if len(adds) == 0 {
+		return nil
+	}
+
+	// Membership is per org, the same login may be on one org and not on another
+	orgMembers := map[string]map[string]bool{}
+	invited := map[string]map[string]bool{}
+	for _, c := range adds {
+		org := strings.ToLower(c.Org)
+		if _, found := orgMembers[org]; found {
+			continue
+		}
+		var err error
+		if orgMembers[org], invited[org], err = s.orgLogins(org); err != nil {
+			return err
+		}
+	}
+
+	exists := map[string]bool{}
+	skipped := map[string]string{}
+	inviting := map[string]bool{}
+	for _, c := range adds {
+		org, login := strings.ToLower(c.Org), strings.ToLower(c.Login)
+		key := org + "/" + login
+		if orgMembers[org][login] {
+			continue
+		}
+		if _, found := skipped[key]; found {
+			continue
+		}
+
+		if _, found := exists[login]; !found {
+			ok, err := s.userExists(c.Login)
+			if err != nil {
+				s.log.WithError(err).Errorf("failed to check user %v", c.Login)
+				return err
+			}
+			exists[login] = ok
+		}
+		switch {
+		case !exists[login]:
+			skipped[key] = ReasonUnknown
+		case invited[org][login]:
+			skipped[key] = ReasonInvited
+		case s.invite:
+			skipped[key] = ReasonInvited
+			inviting[key] = true
+		default:
+			skipped[key] = ReasonNotMember
+		}
+	}
+
+	changes := s.Plan.Changes[:0]
+	for _, c := range s.Plan.Changes {
+		key := strings.ToLower(c.Org + "/" + c.Login)
+		reason, found := skipped[key]
+		if c.Action != ActionAdd || !found {
+			changes = append(changes, c)
+			continue
+		}
+		s.Plan.Skipped = append(s.Plan.Skipped, Skip{Team: s.displayName(c.Org, c.Team), Login: c.Login, Reason: reason})
+
+		// The invitation takes the place of the first addition of the login
+		if inviting[key] {
+			delete(inviting, key)
+			changes = append(changes, Change{Org: c.Org, TeamID: c.TeamID, Team: c.Team, Login: c.Login, Action: ActionInvite})
+		}
+	}
+	s.Plan.Changes = changes
+	return nil
+}
+
+// orgLogins returns the members and the invited users of org
+func (s *Base) orgLogins(org string) (map[string]bool, map[string]bool, error) {
+	members, err := s.ghc.ListOrgMembers(org, "all")
+	if err != nil {
+		s.log.WithError(err).Errorf("failed to list %v members", org)
+		return nil, nil, err
+	}
+	orgMembers := make(map[string]bool, len(members))
+	for _, m := range members {
+		orgMembers[strings.ToLower(m.Login)] = true
+	}
+
+	invitations, err := s.ghc.ListOrgInvitations(org)
+	if err != nil {
+		s.log.WithError(err).Errorf("failed to list %v invitations", org)
+		return nil, nil, err
+	}
+	invited := make(map[string]bool, len(invitations))
+	for _, i := range invitations {
+		invited[strings.ToLower(i.Login)] = true
+	}
+	return orgMembers, invited, nil
+}
+
+// userExists tells if login is a github user, graphql fails to resolve the
+// unknown ones
+func (s *Base) userExists(login string) (bool, error) {
+	q := userQuery{}
+	err := s.ghc.Query(context.Background(), &q, map[string]interface{}{"login": githubql.String(login)})
+	if err != nil && strings.Contains(err.Error(), "Could not resolve to a User") {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,101 @@
+package file
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestValidateMembers(t *testing.T) {
+	add := func(org, team, login string) Change {
+		return Change{Org: org, TeamID: 1, Team: team, Login: login, Action: ActionAdd}
+	}
+	invite := func(org, team, login string) Change {
+		return Change{Org: org, TeamID: 1, Team: team, Login: login, Action: ActionInvite}
+	}
+	remove := Change{Org: "org", TeamID: 1, Team: "backend", Login: "dave", Action: ActionRemove}
+
+	ghc := &fakeGithub{
+		members: map[string][]string{"org": {"Alice"}, "org-b": {"bob"}},
+		invited: map[string][]string{"org": {"carol"}},
+		users:   sets.NewString("alice", "bob", "carol"),
+	}
+
+	tests := []struct {
+		name     string
+		invite   bool
+		changes  []Change
+		expected []Change
+		skipped  []Skip
+	}{
+		{
+			name:     "org members are added",
+			changes:  []Change{add("org", "backend", "alice"), remove},
+			expected: []Change{add("org", "backend", "alice"), remove},
+		},
+		{
+			name:     "unknown users are skipped",
+			changes:  []Change{add("org", "backend", "ghost"), remove},
+			expected: []Change{remove},
+			skipped:  []Skip{{Team: "backend", Login: "ghost", Reason: ReasonUnknown}},
+		},
+		{
+			name:    "non members are skipped",
+			changes: []Change{add("org", "backend", "bob")},
+			skipped: []Skip{{Team: "backend", Login: "bob", Reason: ReasonNotMember}},
+		},
+		{
+			name:    "invited users wait for the invitation",
+			invite:  true,
+			changes: []Change{add("org", "backend", "carol")},
+			skipped: []Skip{{Team: "backend", Login: "carol", Reason: ReasonInvited}},
+		},
+		{
+			name:     "non members are invited once",
+			invite:   true,
+			changes:  []Change{add("org", "backend", "bob"), add("org", "frontend", "bob")},
+			expected: []Change{invite("org", "backend", "bob")},
+			skipped: []Skip{
+				{Team: "backend", Login: "bob", Reason: ReasonInvited},
+				{Team: "frontend", Login: "bob", Reason: ReasonInvited},
+			},
+		},
+		{
+			name:    "unknown users are not invited",
+			invite:  true,
+			changes: []Change{add("org", "backend", "ghost")},
+			skipped: []Skip{{Team: "backend", Login: "ghost", Reason: ReasonUnknown}},
+		},
+		{
+			name:     "membership is checked on the org of the team",
+			changes:  []Change{add("org-b", "infra", "bob"), add("org", "backend", "bob")},
+			expected: []Change{add("org-b", "infra", "bob")},
+			skipped:  []Skip{{Team: "backend", Login: "bob", Reason: ReasonNotMember}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := New(logrus.NewEntry(logrus.New()), ghc, nil, nil, "org")
+			if tc.invite {
+				b.EnableInvite()
+			}
+			b.Plan.Changes = tc.changes
+
+			if err := b.validateMembers(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(b.Plan.Changes) == 0 {
+				b.Plan.Changes = nil
+			}
+			if !reflect.DeepEqual(b.Plan.Changes, tc.expected) {
+				t.Errorf("expected changes %+v, got %+v", tc.expected, b.Plan.Changes)
+			}
+			if !reflect.DeepEqual(b.Plan.Skipped, tc.skipped) {
+				t.Errorf("expected skipped %+v, got %+v", tc.skipped, b.Plan.Skipped)
+			}
+		})
+	}
+}
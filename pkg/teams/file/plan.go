@@ -0,0 +1,203 @@
+package file
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Action is what a change does to a team, its members or its repos
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionEdit   Action = "edit"
+	ActionAdd    Action = "add"
+	ActionRemove Action = "remove"
+	ActionUpdate Action = "update"
+	ActionGrant  Action = "grant"
+	ActionRevoke Action = "revoke"
+	ActionInvite Action = "invite"
+)
+
+// Change is a single operation on a github team, on a repo permission when
+// Repo is set and on a membership otherwise
+type Change struct {
+	Org        string
+	TeamID     int
+	Team       string
+	Login      string
+	Action     Action
+	Maintainer bool
+	// WasMaintainer is the role the member has on github, set on updates
+	WasMaintainer bool
+	// NewTeam holds the settings of the team, set on creates and edits
+	NewTeam *Team
+	// Diff describes the settings changed by an edit
+	Diff []string
+	Repo string
+	// Permission and WasPermission are the file and github repo levels
+	Permission    string
+	WasPermission string
+}
+
+// Plan is the list of changes needed to make github match the file
+type Plan struct {
+	Changes []Change
+	// Skipped are the declared members that can't be added to their team
+	Skipped []Skip
+}
+
+// Empty tells if there is nothing to apply
+func (p Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Count returns how many changes have the given action
+func (p Plan) Count(action Action) int {
+	count := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Removals returns the members that are on github but not on the file, by
+// team, teams are prefixed with their org when the plan spans several
+func (p Plan) Removals() map[string][]string {
+	multiOrg := len(p.Orgs()) > 1
+	removals := map[string][]string{}
+	for _, c := range p.Changes {
+		if c.Action != ActionRemove {
+			continue
+		}
+		team := c.Team
+		if multiOrg {
+			team = c.Org + "/" + c.Team
+		}
+		removals[team] = append(removals[team], c.Login)
+	}
+	return removals
+}
+
+// Orgs returns the orgs the plan changes
+func (p Plan) Orgs() []string {
+	seen := map[string]bool{}
+	var orgs []string
+	for _, c := range p.Changes {
+		if org := strings.ToLower(c.Org); !seen[org] {
+			seen[org] = true
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Strings(orgs)
+	return orgs
+}
+
+// String renders the plan as a terraform like diff
+func (p Plan) String() string {
+	if p.Empty() && len(p.Skipped) == 0 {
+		return "No changes. GitHub teams are up-to-date."
+	}
+
+	var b strings.Builder
+	if !p.Empty() {
+		p.writeChanges(&b)
+	}
+	if len(p.Skipped) != 0 {
+		b.WriteString("\n\nSkipped members:\n")
+		for _, s := range p.Skipped {
+			fmt.Fprintf(&b, "- `%v` on `%v`: %v\n", s.Login, s.Team, s.Reason)
+		}
+	}
+	return strings.TrimPrefix(b.String(), "\n\n")
+}
+
+// writeChanges renders the changes grouped by org and team, orgs are only
+// named when the plan spans more than one
+func (p Plan) writeChanges(b *strings.Builder) {
+	orgs := p.Orgs()
+	changes := append([]Change(nil), p.Changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return strings.ToLower(changes[i].Org) < strings.ToLower(changes[j].Org)
+	})
+
+	b.WriteString("```diff\n")
+	org, team := "", ""
+	for _, c := range changes {
+		if len(orgs) > 1 && !strings.EqualFold(c.Org, org) {
+			org = c.Org
+			fmt.Fprintf(b, "@@ org %v @@\n", org)
+		}
+		if c.Action == ActionCreate {
+			team = teamKey(c.Org, c.Team)
+			fmt.Fprintf(b, "+ team %q (%v)\n", c.Team, c.NewTeam.Privacy)
+			continue
+		}
+		if teamKey(c.Org, c.Team) != team {
+			team = teamKey(c.Org, c.Team)
+			fmt.Fprintf(b, "  team %q\n", c.Team)
+		}
+		switch c.Action {
+		case ActionGrant:
+			fmt.Fprintf(b, "+     repo %v (%v)\n", c.Repo, c.Permission)
+		case ActionRevoke:
+			fmt.Fprintf(b, "-     repo %v (%v)\n", c.Repo, c.WasPermission)
+		case ActionUpdate:
+			if c.Repo != "" {
+				fmt.Fprintf(b, "!     repo %v: %v -> %v\n", c.Repo, c.WasPermission, c.Permission)
+				break
+			}
+			fmt.Fprintf(b, "!     %v: %v -> %v\n", c.Login, role(c.WasMaintainer), role(c.Maintainer))
+		case ActionInvite:
+			fmt.Fprintf(b, "+     %v (org invitation)\n", c.Login)
+		case ActionAdd:
+			fmt.Fprintf(b, "+     %v (%v)\n", c.Login, role(c.Maintainer))
+		case ActionRemove:
+			fmt.Fprintf(b, "-     %v (%v)\n", c.Login, role(c.WasMaintainer))
+		case ActionEdit:
+			for _, d := range c.Diff {
+				fmt.Fprintf(b, "!   %v\n", d)
+			}
+		}
+	}
+	b.WriteString("```\n")
+	b.WriteString("Plan: ")
+	if creates := p.Count(ActionCreate); creates != 0 {
+		fmt.Fprintf(b, "%v teams to create, ", creates)
+	}
+	if invites := p.Count(ActionInvite); invites != 0 {
+		fmt.Fprintf(b, "%v to invite, ", invites)
+	}
+	fmt.Fprintf(b, "%v to add, %v to change, %v to remove.",
+		p.Count(ActionAdd)+p.Count(ActionGrant), p.Count(ActionUpdate)+p.Count(ActionEdit), p.Count(ActionRemove)+p.Count(ActionRevoke))
+}
+
+// Describe tells what the change does in a few words
+func (c Change) Describe() string {
+	switch {
+	case c.Action == ActionCreate:
+		return fmt.Sprintf("create team (%v)", c.NewTeam.Privacy)
+	case c.Action == ActionEdit:
+		return "edit " + strings.Join(c.Diff, ", ")
+	case c.Action == ActionInvite:
+		return fmt.Sprintf("invite %v to the org", c.Login)
+	case c.Repo != "" && c.Action == ActionRevoke:
+		return fmt.Sprintf("revoke repo %v", c.Repo)
+	case c.Repo != "":
+		return fmt.Sprintf("%v repo %v (%v)", c.Action, c.Repo, c.Permission)
+	case c.Action == ActionRemove:
+		return fmt.Sprintf("remove %v", c.Login)
+	default:
+		return fmt.Sprintf("%v %v (%v)", c.Action, c.Login, role(c.Maintainer))
+	}
+}
+
+func role(maintainer bool) string {
+	if maintainer {
+		return "maintainer"
+	}
+	return "member"
+}
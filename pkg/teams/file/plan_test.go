@@ -0,0 +1,81 @@
+package file
+
+import (
+	"testing"
+)
+
+func TestPlanString(t *testing.T) {
+	tests := []struct {
+		name     string
+		plan     Plan
+		expected string
+	}{
+		{
+			name:     "empty plan",
+			expected: "No changes. GitHub teams are up-to-date.",
+		},
+		{
+			name: "members of a team",
+			plan: Plan{Changes: []Change{
+				{Org: "org", Team: "backend", Login: "alice", Action: ActionAdd, Maintainer: true},
+				{Org: "org", Team: "backend", Login: "bob", Action: ActionRemove},
+				{Org: "org", Team: "backend", Login: "carol", Action: ActionUpdate, WasMaintainer: true},
+			}},
+			expected: "```diff\n" +
+				"  team \"backend\"\n" +
+				"+     alice (maintainer)\n" +
+				"-     bob (member)\n" +
+				"!     carol: maintainer -> member\n" +
+				"```\n" +
+				"Plan: 1 to add, 1 to change, 1 to remove.",
+		},
+		{
+			name: "created team and repos",
+			plan: Plan{Changes: []Change{
+				{Org: "org", Team: "frontend", Action: ActionCreate, NewTeam: &Team{Privacy: "closed"}},
+				{Org: "org", Team: "frontend", Login: "alice", Action: ActionAdd},
+				{Org: "org", Team: "frontend", Repo: "web", Action: ActionGrant, Permission: "push"},
+				{Org: "org", Team: "frontend", Repo: "api", Action: ActionUpdate, WasPermission: "pull", Permission: "push"},
+				{Org: "org", Team: "frontend", Repo: "old", Action: ActionRevoke, WasPermission: "admin"},
+			}},
+			expected: "```diff\n" +
+				"+ team \"frontend\" (closed)\n" +
+				"+     alice (member)\n" +
+				"+     repo web (push)\n" +
+				"!     repo api: pull -> push\n" +
+				"-     repo old (admin)\n" +
+				"```\n" +
+				"Plan: 1 teams to create, 2 to add, 1 to change, 1 to remove.",
+		},
+		{
+			name: "several orgs",
+			plan: Plan{Changes: []Change{
+				{Org: "org-b", Team: "ops", Login: "bob", Action: ActionInvite},
+				{Org: "org-a", Team: "backend", Diff: []string{`privacy: "secret" -> "closed"`}, Action: ActionEdit},
+			}},
+			expected: "```diff\n" +
+				"@@ org org-a @@\n" +
+				"  team \"backend\"\n" +
+				"!   privacy: \"secret\" -> \"closed\"\n" +
+				"@@ org org-b @@\n" +
+				"  team \"ops\"\n" +
+				"+     bob (org invitation)\n" +
+				"```\n" +
+				"Plan: 1 to invite, 0 to add, 1 to change, 0 to remove.",
+		},
+		{
+			name: "skipped members only",
+			plan: Plan{Skipped: []Skip{{Team: "backend", Login: "ghost", Reason: "not an org member"}}},
+			expected: "Skipped members:\n" +
+				"- `ghost` on `backend`: not an org member\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if s := tc.plan.String(); s != tc.expected {
+				t.Errorf("expected:\n%v\ngot:\n%v", tc.expected, s)
+			}
+		})
+	}
+}
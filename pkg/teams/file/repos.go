@@ -0,0 +1,123 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+	"k8s.io/test-infra/prow/github"
+)
+
+// Repo is the permission a team has on a repo of the org
+type Repo struct {
+	Name       string `yaml:"name"`
+	Permission string `yaml:"permission"`
+}
+
+// permissions maps the TEAMS file levels to the values of the REST API
+var permissions = map[string]string{
+	"read":     "pull",
+	"triage":   "triage",
+	"write":    "push",
+	"maintain": "maintain",
+	"admin":    "admin",
+}
+
+type teamReposQuery struct {
+	Organization struct {
+		Team struct {
+			Repositories struct {
+				Edges []struct {
+					Permission githubql.String
+					Node       struct {
+						Name githubql.String
+					}
+				}
+				PageInfo struct {
+					HasNextPage githubql.Boolean
+					EndCursor   githubql.String
+				}
+			} `graphql:"repositories(first: 100, after: $cursor)"`
+		} `graphql:"team(slug: $slug)"`
+	} `graphql:"organization(login: $org)"`
+}
+
+func validateRepos(team Team) error {
+	for _, r := range team.Repos {
+		if r.Name == "" {
+			return fmt.Errorf("team %v has a repo without name", team.Name)
+		}
+		if _, ok := permissions[r.Permission]; !ok {
+			return fmt.Errorf("team %v repo %v: permission %q must be read, triage, write, maintain or admin", team.Name, r.Name, r.Permission)
+		}
+	}
+	return nil
+}
+
+// teamRepos returns the permission of the team on each repo, by repo name.
+// It uses graphql because the REST API drops the triage and maintain levels
+func (s *Base) teamRepos(org, slug string) (map[string]string, error) {
+	repos := map[string]string{}
+	vars := map[string]interface{}{
+		"org":    githubql.String(org),
+		"slug":   githubql.String(slug),
+		"cursor": (*githubql.String)(nil),
+	}
+
+	for {
+		q := teamReposQuery{}
+		if err := s.ghc.Query(context.Background(), &q, vars); err != nil {
+			return nil, err
+		}
+
+		r := q.Organization.Team.Repositories
+		for _, e := range r.Edges {
+			repos[strings.ToLower(string(e.Node.Name))] = strings.ToLower(string(e.Permission))
+		}
+		if !r.PageInfo.HasNextPage {
+			return repos, nil
+		}
+		vars["cursor"] = githubql.NewString(r.PageInfo.EndCursor)
+	}
+}
+
+// reposDiff returns the changes that make the team repos on github match the
+// file, repos missing on the file are revoked
+func reposDiff(team Team, current map[string]string) []Change {
+	var changes []Change
+	declared := make(map[string]struct{}, len(team.Repos))
+	for _, r := range team.Repos {
+		name := strings.ToLower(r.Name)
+		declared[name] = struct{}{}
+
+		permission, found := current[name]
+		switch {
+		case !found:
+			changes = append(changes, Change{Org: team.Org, TeamID: team.ID, Team: team.Name, Repo: r.Name, Action: ActionGrant, Permission: r.Permission})
+		case permission != r.Permission:
+			changes = append(changes, Change{Org: team.Org, TeamID: team.ID, Team: team.Name, Repo: r.Name, Action: ActionUpdate, Permission: r.Permission, WasPermission: permission})
+		}
+	}
+
+	var revoked []string
+	for name := range current {
+		if _, found := declared[name]; !found {
+			revoked = append(revoked, name)
+		}
+	}
+	sort.Strings(revoked)
+	for _, name := range revoked {
+		changes = append(changes, Change{Org: team.Org, TeamID: team.ID, Team: team.Name, Repo: name, Action: ActionRevoke, WasPermission: current[name]})
+	}
+	return changes
+}
+
+// syncRepo applies a repo permission change
+func (s *Base) syncRepo(id int, c Change) error {
+	if c.Action == ActionRevoke {
+		return s.ghc.RemoveTeamRepo(id, c.Org, c.Repo)
+	}
+	return s.ghc.UpdateTeamRepo(id, c.Org, c.Repo, github.RepoPermissionLevel(permissions[c.Permission]))
+}
@@ -0,0 +1,60 @@
+package file
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReposDiff(t *testing.T) {
+	change := func(repo string, action Action, permission, was string) Change {
+		return Change{Org: "org", TeamID: 1, Team: "team", Repo: repo, Action: action, Permission: permission, WasPermission: was}
+	}
+
+	tests := []struct {
+		name     string
+		repos    []Repo
+		current  map[string]string
+		expected []Change
+	}{
+		{
+			name:    "up to date",
+			repos:   []Repo{{Name: "api", Permission: "push"}},
+			current: map[string]string{"api": "push"},
+		},
+		{
+			name:     "declared repos are granted",
+			repos:    []Repo{{Name: "api", Permission: "push"}, {Name: "web", Permission: "pull"}},
+			current:  map[string]string{"api": "push"},
+			expected: []Change{change("web", ActionGrant, "pull", "")},
+		},
+		{
+			name:     "permissions are updated",
+			repos:    []Repo{{Name: "api", Permission: "admin"}},
+			current:  map[string]string{"api": "push"},
+			expected: []Change{change("api", ActionUpdate, "admin", "push")},
+		},
+		{
+			name:    "repo names are case insensitive",
+			repos:   []Repo{{Name: "API", Permission: "push"}},
+			current: map[string]string{"api": "push"},
+		},
+		{
+			name:    "undeclared repos are revoked in order",
+			repos:   []Repo{},
+			current: map[string]string{"web": "pull", "api": "push"},
+			expected: []Change{
+				change("api", ActionRevoke, "", "push"),
+				change("web", ActionRevoke, "", "pull"),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			team := Team{Org: "org", ID: 1, Name: "team", Repos: tc.repos}
+			if changes := reposDiff(team, tc.current); !reflect.DeepEqual(changes, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, changes)
+			}
+		})
+	}
+}
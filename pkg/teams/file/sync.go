@@ -0,0 +1,77 @@
+package file
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	// maxAttempts and retryDelay bound the retries of transient errors, the
+	// delay doubles on every attempt
+	maxAttempts = 3
+	retryDelay  = 2 * time.Second
+	// transientErrors are the github client errors worth retrying
+	transientErrors = []string{
+		"rate limit",
+		"status code 5",
+		"timeout",
+		"connection reset",
+		"connection refused",
+	}
+)
+
+// Result is the outcome of a change applied by Sync
+type Result struct {
+	Change   Change
+	Attempts int
+	Err      error
+}
+
+// retry runs fn until it succeeds, fails with a permanent error or runs out
+// of attempts, it returns how many attempts were made
+func retry(fn func() error) (int, error) {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == maxAttempts || !transient(err) {
+			return attempt, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func transient(err error) bool {
+	if e, ok := err.(net.Error); ok && e.Temporary() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, t := range transientErrors {
+		if strings.Contains(msg, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultTable renders the results of Sync as a markdown table
+func (s *Base) ResultTable() string {
+	var b strings.Builder
+	b.WriteString("| Team | Change | Result |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for _, r := range s.Results {
+		result := ":white_check_mark: done"
+		if r.Err != nil {
+			// Pipes and new lines would break the table
+			msg := strings.NewReplacer("|", "\\|", "\n", " ").Replace(r.Err.Error())
+			result = fmt.Sprintf(":x: `%v`", msg)
+		}
+		if r.Attempts > 1 {
+			result += fmt.Sprintf(" after %v attempts", r.Attempts)
+		}
+		fmt.Fprintf(&b, "| %v | %v | %v |\n", s.displayName(r.Change.Org, r.Change.Team), r.Change.Describe(), result)
+	}
+	return b.String()
+}
@@ -18,7 +18,9 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
 )
 
 func (s *Server) handleCommentEvent(l *logrus.Entry, e *github.IssueCommentEvent) (err error) {
@@ -27,18 +29,32 @@ func (s *Server) handleCommentEvent(l *logrus.Entry, e *github.IssueCommentEvent
 		repo   = e.Repo.Name
 		number = e.Issue.Number
 		body   = e.Comment.Body
-		action = ""
 	)
 
+	if e.Action != github.IssueCommentActionCreated {
+		return nil
+	}
+
+	// Teams can be imported from any issue or pull request
+	if m := importRe.FindStringSubmatch(body); m != nil {
+		return s.handleImport(l, org, repo, e.Comment.User.Login, number, strings.Fields(m[1]))
+	}
+
+	if m := offboardRe.FindStringSubmatch(body); m != nil {
+		return s.handleOffboard(l, org, repo, e.Comment.User.Login, number, m[1])
+	}
+
+	if !e.Issue.IsPullRequest() {
+		return nil
+	}
+
 	pr, err := s.Ghc.GetPullRequest(org, repo, number)
 	if err != nil {
 		l.WithError(err).Error("failed to get pull request")
-		return err
+		return plugin.Retryable(err)
 	}
-	commit := pr.Head.Ref
-	state := github.ReviewState(strings.ToUpper(string(pr.State)))
 
-	err = s.handle(l, org, repo, action, commit, body, true, number, state)
+	err = s.handle(l, org, repo, e.Comment.User.Login, body, true, pr)
 	if err != nil {
 		l.WithError(err).Error("failed do handle request on handle comment")
 		return err
@@ -46,36 +62,65 @@ func (s *Server) handleCommentEvent(l *logrus.Entry, e *github.IssueCommentEvent
 	return err
 }
 
-func (s *Server) handleReviewEvent(l *logrus.Entry, e *github.ReviewEvent) (err error) {
+func (s *Server) handlePR(l *logrus.Entry, e *github.PullRequestEvent) (err error) {
 	var (
-		org    = e.Repo.Owner.Login
-		repo   = e.PullRequest.Base.Repo.Name
-		number = e.PullRequest.Number
-		state  = github.ReviewState(strings.ToUpper(string(e.PullRequest.State)))
-		commit = e.PullRequest.Head.Ref
-		action = ""
+		org  = e.Repo.Owner.Login
+		repo = e.PullRequest.Base.Repo.Name
 	)
-	err = s.handle(l, org, repo, action, commit, "", false, number, state)
+
+	// Plans are commented while the pull request changes and applied on merge
+	switch e.Action {
+	case github.PullRequestActionOpened, github.PullRequestActionReopened, github.PullRequestActionSynchronize:
+	case github.PullRequestActionClosed:
+		if !e.PullRequest.Merged {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if s.Config.Codeowners.Enabled {
+		if err := s.handleCodeowners(l, org, repo, &e.PullRequest); err != nil {
+			l.WithError(err).Error("failed to handle CODEOWNERS")
+		}
+	}
+
+	err = s.handle(l, org, repo, "", "", false, &e.PullRequest)
 	if err != nil {
-		l.WithError(err).Error("failed do handle request on pull request review")
+		l.WithError(err).Error("failed do handle request on pull request")
 		return err
 	}
 	return err
 }
 
-func (s *Server) handlePR(l *logrus.Entry, e *github.PullRequestEvent) (err error) {
-	var (
-		org    = e.Repo.Owner.Login
-		repo   = e.PullRequest.Base.Repo.Name
-		number = e.PullRequest.Number
-		state  = github.ReviewState(strings.ToUpper(string(e.PullRequest.State)))
-		commit = e.PullRequest.Head.Ref
-		action = ""
-	)
-	err = s.handle(l, org, repo, action, commit, "", false, number, state)
+// approved tells if the pull request has the approved label or an approving
+// review, with no reviewer still requesting changes
+func (s *Server) approved(org, repo string, pr *github.PullRequest) (bool, error) {
+	for _, label := range pr.Labels {
+		if label.Name == labels.Approved {
+			return true, nil
+		}
+	}
+
+	reviews, err := s.Ghc.ListReviews(org, repo, pr.Number)
 	if err != nil {
-		l.WithError(err).Error("failed do handle request on pull request")
-		return err
+		return false, err
 	}
-	return err
+
+	// Only the last approving or blocking review of each reviewer counts
+	latest := map[string]github.ReviewState{}
+	for _, r := range reviews {
+		if r.State == github.ReviewStateApproved || r.State == github.ReviewStateChangesRequested {
+			latest[github.NormLogin(r.User.Login)] = r.State
+		}
+	}
+
+	approved := false
+	for _, state := range latest {
+		if state == github.ReviewStateChangesRequested {
+			return false, nil
+		}
+		approved = true
+	}
+	return approved, nil
 }
@@ -18,6 +18,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
 	"github.com/dafiti-group/prow-plugins/pkg/teams/file"
 	"github.com/sirupsen/logrus"
 	"k8s.io/test-infra/prow/github"
@@ -26,12 +27,25 @@ import (
 var (
 	succesMessage = "Teams were synced"
 	failMessage   = "Failed to sync Teams: `%v`"
-	usersDiffMsg  = "Some users are on the organization but are not declared on the OWNERS_ALIAS, please remove them manualy or update the file: %v"
-	PRNotApproved = "Your pull request is not approved yet. I will wait to sync the file with github"
+	usersDiffMsg  = "Some users are on the organization but are not declared on the TEAMS or OWNERS_ALIASES file, please remove them manualy or update the file: %v"
+	planMsg       = "Teams sync plan:\n%v"
+	missingMsg    = "Teams `%v` are not on github, create them or enable `createTeams` on the plugin config"
+	createdMsg    = "Created teams: `%v`"
+	notAdminMsg   = "I am not an owner of the `%v` orgs, ask an owner to make me one before syncing their teams"
+	PRNotApproved = "Your pull request was merged without approval, teams were not synced. Get it approved and comment `/sync-teams` to sync them"
+	PRNotMerged   = "Teams are synced when this pull request is merged"
+	noChangesMsg  = "This pull request does not change the TEAMS or OWNERS_ALIASES files, there is nothing to sync"
 	syncRe        = regexp.MustCompile(`(?mi)^/sync-teams\s*$`)
 )
 
-func (s *Server) handle(l *logrus.Entry, org, repo, action, commit, body string, isCMD bool, number int, state github.ReviewState) (err error) {
+// handle comments the plan for the head of the pull request and applies it
+// once the pull request is merged and approved
+func (s *Server) handle(l *logrus.Entry, org, repo, user, body string, isCMD bool, pr *github.PullRequest) (err error) {
+	var (
+		number = pr.Number
+		commit = pr.Head.SHA
+	)
+
 	//
 	bodyMatchString := syncRe.MatchString(body)
 
@@ -40,9 +54,8 @@ func (s *Server) handle(l *logrus.Entry, org, repo, action, commit, body string,
 		github.OrgLogField:  org,
 		github.RepoLogField: repo,
 		github.PrLogField:   number,
-		"state":             state,
+		"merged":            pr.Merged,
 		"commit":            commit,
-		"action":            action,
 		"body":              body,
 		"bodyMatchString ":  bodyMatchString,
 	})
@@ -56,73 +69,191 @@ func (s *Server) handle(l *logrus.Entry, org, repo, action, commit, body string,
 		return nil
 	}
 
+	// The command changes org wide teams, only trusted users can run it
+	if isCMD {
+		via, err := s.authorized(l, org, repo, pr.Base.Ref, user)
+		if err != nil {
+			l.WithError(err).Error("failed to authorize user")
+			return err
+		}
+		if via == "" {
+			l.WithField("user", user).Warn("unauthorized /sync-teams")
+			return s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(unauthorizedMsg, user))
+		}
+		l.WithFields(logrus.Fields{"user": user, "authorized-by": via}).Info("audit: /sync-teams invoked")
+	}
+
+	// Only pull requests changing the team files are synced
+	touched, err := s.touchesTeams(org, repo, number)
+	if err != nil {
+		l.WithError(err).Error("failed to list pull request changes")
+		return err
+	}
+	if !touched {
+		l.Info("team files were not changed")
+		if bodyMatchString {
+			return s.Ghc.CreateComment(org, repo, number, noChangesMsg)
+		}
+		return nil
+	}
+
+	previous, err := s.loadTeams(l, org, repo, pr.Base.SHA)
+	if err != nil {
+		return err
+	}
+
 	//
 	botName, err := s.Ghc.BotName()
 	if err != nil {
 		l.WithError(err).Error("failed getting botName")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	// Clear comments
 	if err = s.Ghc.DeleteStaleComments(org, repo, number, nil, shouldPrune(botName)); err != nil {
 		l.WithError(err).Error("failed to prune comments")
-		return err
+		return plugin.Retryable(err)
 	}
 
 	//
 	file := file.New(l, s.Ghc, s.Gc, s.Oc, org)
+	if s.Config.CreateTeams.Enabled {
+		file.EnableCreate(s.Config.CreateTeams.defaults())
+	}
+	if s.Config.Invite {
+		file.EnableInvite()
+	}
 
 	// Clone Repo
 	if err = file.Clone(repo, commit); err != nil {
-		return err
+		return plugin.Retryable(err)
+	}
+
+	// The plan only covers the teams this pull request changes
+	changed := file.ChangedTeams(previous)
+	if len(changed) == 0 {
+		l.Info("no team definition changed")
+		return nil
 	}
+	file.Filter(changed)
+	l = l.WithField("teams", changed)
 
-	// Fetch team ID
+	// Compute the plan
 	if err = file.Fetch(); err != nil {
-		// Comment if there something wrong with the file
-		// @TODO: Check erro type here, This error might not be about this
-		if err = s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(usersDiffMsg, err.Error())); err != nil {
+		return err
+	}
+
+	// Teams of orgs the bot can't manage would fail halfway
+	if len(file.NotAdmin) != 0 {
+		return s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(notAdminMsg, strings.Join(file.NotAdmin, "`, `")))
+	}
+
+	// Teams that are not on github can't be synced
+	if len(file.Missing) != 0 {
+		msg := fmt.Sprintf(missingMsg, strings.Join(file.Missing, "`, `"))
+		if err = s.Ghc.CreateComment(org, repo, number, msg); err != nil {
 			return err
 		}
 		return err
 	}
 
-	// If is not approved and and is valid command comment on PR
-	if state != github.ReviewStateApproved && bodyMatchString {
-		if err = s.Ghc.CreateComment(org, repo, number, PRNotApproved); err != nil {
+	// Without reconcile members missing from the file are not removed
+	if removals := file.Plan.Removals(); len(removals) != 0 && !s.Config.Reconcile {
+		if err = s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(usersDiffMsg, removals)); err != nil {
 			return err
 		}
+		return err
 	}
 
 	//
-	if state != github.ReviewStateApproved {
-		s.Log.Warn(PRNotApproved)
+	if err = s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(planMsg, file.Plan)); err != nil {
+		return err
+	}
+
+	// Changes are only applied once they reach the default branch
+	if !pr.Merged {
+		if bodyMatchString {
+			return s.Ghc.CreateComment(org, repo, number, PRNotMerged)
+		}
 		return nil
 	}
 
 	//
-	if err = file.Sync(); err != nil {
-		if err = s.Ghc.CreateComment(org, repo, number, failMessage); err != nil {
-			return err
-		}
+	approved, err := s.approved(org, repo, pr)
+	if err != nil {
+		l.WithError(err).Error("failed to check approval")
 		return err
 	}
+	if !approved {
+		l.Warn(PRNotApproved)
+		return s.Ghc.CreateComment(org, repo, number, PRNotApproved)
+	}
 
 	//
-	if err = s.Ghc.CreateComment(org, repo, number, succesMessage); err != nil {
+	syncErr := file.Sync()
+
+	//
+	msg := succesMessage
+	if syncErr != nil {
+		msg = fmt.Sprintf(failMessage, syncErr)
+	}
+	if len(file.Created) != 0 {
+		msg += "\n" + fmt.Sprintf(createdMsg, strings.Join(file.Created, "`, `"))
+	}
+	if len(file.Results) != 0 {
+		msg += "\n\n" + file.ResultTable()
+	}
+	if err = s.Ghc.CreateComment(org, repo, number, msg); err != nil {
 		return err
 	}
 
-	return err
+	// The failure is on the comment, syncing again could repeat the changes
+	if syncErr != nil {
+		l.WithError(syncErr).Error("failed to sync teams")
+	}
+	return nil
 }
 
 //
 func shouldPrune(botName string) func(github.IssueComment) bool {
 	return func(ic github.IssueComment) bool {
-		hasMsgs := strings.Contains(ic.Body, succesMessage) ||
-			strings.ContainsAny(ic.Body, failMessage) ||
-			strings.ContainsAny(ic.Body, usersDiffMsg) ||
-			strings.ContainsAny(ic.Body, PRNotApproved)
+		// The CODEOWNERS diff is pruned by its own handler
+		if strings.Contains(ic.Body, codeownersMarker) {
+			return false
+		}
+		hasMsgs := strings.HasPrefix(ic.Body, succesMessage) ||
+			strings.HasPrefix(ic.Body, msgPrefix(planMsg)) ||
+			strings.HasPrefix(ic.Body, msgPrefix(missingMsg)) ||
+			strings.HasPrefix(ic.Body, msgPrefix(notAdminMsg)) ||
+			strings.HasPrefix(ic.Body, msgPrefix(failMessage)) ||
+			strings.HasPrefix(ic.Body, msgPrefix(usersDiffMsg)) ||
+			strings.HasPrefix(ic.Body, msgPrefix(PRNotApproved)) ||
+			ic.Body == PRNotMerged
 		return github.NormLogin(botName) == github.NormLogin(ic.User.Login) && hasMsgs
 	}
 }
+
+// msgPrefix is the fixed part of a message before its first verb
+func msgPrefix(msg string) string {
+	return strings.SplitN(msg, "%", 2)[0]
+}
+
+// touchesTeams tells if the pull request changes a team file
+func (s *Server) touchesTeams(org, repo string, number int) (bool, error) {
+	changes, err := s.Ghc.GetPullRequestChanges(org, repo, number)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range changes {
+		if file.Managed(c.Filename) || file.Managed(c.PreviousFilename) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadTeams reads the teams declared at commit
+func (s *Server) loadTeams(l *logrus.Entry, org, repo, commit string) (*file.Base, error) {
+	teams := file.New(l, s.Ghc, s.Gc, s.Oc, org)
+	return teams, teams.Clone(repo, commit)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestShouldPrune(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		body     string
+		expected bool
+	}{
+		{
+			name:     "success",
+			user:     "bot",
+			body:     succesMessage + "\n\n| team | change |",
+			expected: true,
+		},
+		{
+			name:     "failure",
+			user:     "bot",
+			body:     fmt.Sprintf(failMessage, "boom"),
+			expected: true,
+		},
+		{
+			name:     "plan",
+			user:     "bot",
+			body:     fmt.Sprintf(planMsg, "```diff\n```"),
+			expected: true,
+		},
+		{
+			name:     "missing teams",
+			user:     "bot",
+			body:     fmt.Sprintf(missingMsg, "backend"),
+			expected: true,
+		},
+		{
+			name:     "not an org admin",
+			user:     "bot",
+			body:     fmt.Sprintf(notAdminMsg, "org"),
+			expected: true,
+		},
+		{
+			name:     "users diff",
+			user:     "bot",
+			body:     fmt.Sprintf(usersDiffMsg, "alice"),
+			expected: true,
+		},
+		{
+			name:     "not approved",
+			user:     "bot",
+			body:     PRNotApproved,
+			expected: true,
+		},
+		{
+			name:     "not merged",
+			user:     "BOT",
+			body:     PRNotMerged,
+			expected: true,
+		},
+		{
+			name: "other users",
+			user: "alice",
+			body: fmt.Sprintf(failMessage, "boom"),
+		},
+		{
+			name: "other bot comments",
+			user: "bot",
+			body: "Deploying `1a2b3c4` to **staging** with job `deploy-staging`",
+		},
+		{
+			name: "messages quoted inside other comments",
+			user: "bot",
+			body: "Deploy failed: " + PRNotApproved,
+		},
+		{
+			name: "codeowners diff",
+			user: "bot",
+			body: fmt.Sprintf(codeownersMsg, codeownersPath, "+ * @carol\n"),
+		},
+	}
+
+	prune := shouldPrune("bot")
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := github.IssueComment{Body: tc.body, User: github.User{Login: tc.user}}
+			if pruned := prune(ic); pruned != tc.expected {
+				t.Errorf("expected pruned %v, got %v", tc.expected, pruned)
+			}
+		})
+	}
+}
+
+func TestTouchesTeams(t *testing.T) {
+	tests := []struct {
+		name     string
+		changes  []github.PullRequestChange
+		expected bool
+	}{
+		{
+			name: "no changes",
+		},
+		{
+			name:     "TEAMS",
+			changes:  []github.PullRequestChange{{Filename: "README.md"}, {Filename: "TEAMS"}},
+			expected: true,
+		},
+		{
+			name:     "OWNERS_ALIASES",
+			changes:  []github.PullRequestChange{{Filename: "OWNERS_ALIASES"}},
+			expected: true,
+		},
+		{
+			name:     "renamed team file",
+			changes:  []github.PullRequestChange{{Filename: "OWNERS_ALIASES.old", PreviousFilename: "OWNERS_ALIASES"}},
+			expected: true,
+		},
+		{
+			name:    "other files",
+			changes: []github.PullRequestChange{{Filename: "README.md"}, {Filename: "OWNERS"}},
+		},
+		{
+			name:    "team files of subdirectories",
+			changes: []github.PullRequestChange{{Filename: "docs/TEAMS"}, {Filename: "pkg/OWNERS_ALIASES"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{Ghc: &fakeGithub{changes: tc.changes}}
+			touched, err := s.touchesTeams("org", "repo", 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if touched != tc.expected {
+				t.Errorf("expected touched %v, got %v", tc.expected, touched)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	importRe        = regexp.MustCompile(`(?mi)^/import-teams((?:[ \t]+\S+)*)[ \t]*$`)
+	importTitle     = "Import GitHub teams to OWNERS_ALIASES"
+	importBody      = "Adds the members of the GitHub teams %v to `%v`, so they can be managed with `/sync-teams`."
+	importBranch    = "prow-plugins/import-teams-%v-%v"
+	importOpenedMsg = "Opened #%v with the imported teams"
+	importNoopMsg   = "`%v` already matches the GitHub teams"
+	importFailedMsg = "Failed to import teams: `%v`"
+	notMemberMsg    = "@%v only members of the `%v` org can import teams"
+)
+
+// handleImport answers an /import-teams comment with a pull request
+func (s *Server) handleImport(l *logrus.Entry, org, repo, user string, number int, names []string) error {
+	l = l.WithField("teams", names)
+
+	member, err := s.Ghc.IsMember(org, user)
+	if err != nil {
+		l.WithError(err).Error("failed to check org membership")
+		return err
+	}
+	if !member {
+		return s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(notMemberMsg, user, org))
+	}
+
+	pr, err := ImportTeams(l, s.Ghc, s.Gc, org, repo, names)
+	msg := fmt.Sprintf(importOpenedMsg, pr)
+	switch {
+	case err != nil:
+		msg = fmt.Sprintf(importFailedMsg, err)
+	case pr == 0:
+		msg = fmt.Sprintf(importNoopMsg, ownersAliasesName)
+	}
+	if cErr := s.Ghc.CreateComment(org, repo, number, msg); cErr != nil {
+		l.WithError(cErr).Error("failed to comment")
+	}
+	return err
+}
+
+// ImportTeams writes the members of the named teams of org, or of all of
+// them when names is empty, to the OWNERS_ALIASES of repo and opens a pull
+// request. Aliases of other teams are kept. It returns 0 when nothing changed
+func ImportTeams(l *logrus.Entry, ghc github.Client, gc git.ClientFactory, org, repo string, names []string) (int, error) {
+	teams, err := importedTeams(ghc, org, names)
+	if err != nil {
+		l.WithError(err).Error("failed to list teams")
+		return 0, err
+	}
+
+	r, err := ghc.GetRepo(org, repo)
+	if err != nil {
+		l.WithError(err).Error("failed to get repo")
+		return 0, err
+	}
+
+	c, err := gc.ClientFor(org, repo)
+	if err != nil {
+		l.WithError(err).Error("failed to clone repo")
+		return 0, err
+	}
+	defer func() {
+		if err := c.Clean(); err != nil {
+			l.WithError(err).Error("failed to clean repo")
+		}
+	}()
+
+	if err = c.Checkout(r.DefaultBranch); err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(c.Directory(), ownersAliasesName)
+	current, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	a := struct {
+		Aliases map[string][]string `yaml:"aliases"`
+	}{}
+	if err = yaml.Unmarshal(current, &a); err != nil {
+		return 0, fmt.Errorf("failed to parse %v: %v", ownersAliasesName, err)
+	}
+	if a.Aliases == nil {
+		a.Aliases = map[string][]string{}
+	}
+
+	var slugs []string
+	for _, t := range teams {
+		members, err := ghc.ListTeamMembers(t.ID, github.RoleAll)
+		if err != nil {
+			l.WithError(err).Errorf("failed to list members of %v", t.Slug)
+			return 0, err
+		}
+		logins := make([]string, 0, len(members))
+		for _, m := range members {
+			logins = append(logins, strings.ToLower(m.Login))
+		}
+		a.Aliases[t.Slug] = logins
+		slugs = append(slugs, "`"+t.Slug+"`")
+	}
+
+	generated := renderAliases(a.Aliases)
+	if generated == string(current) {
+		return 0, nil
+	}
+
+	// Every import gets its own branch so an open import does not block the next
+	branch := fmt.Sprintf(importBranch, repo, time.Now().Unix())
+	if err = c.CheckoutNewBranch(branch); err != nil {
+		return 0, err
+	}
+	if err = ioutil.WriteFile(path, []byte(generated), 0644); err != nil {
+		return 0, err
+	}
+
+	body := fmt.Sprintf(importBody, strings.Join(slugs, ", "), ownersAliasesName)
+	if err = c.Commit(importTitle, body); err != nil {
+		return 0, err
+	}
+	if err = c.PushToCentral(branch, true); err != nil {
+		return 0, err
+	}
+	return ghc.CreatePullRequest(org, repo, importTitle, body, branch, r.DefaultBranch, true)
+}
+
+// importedTeams returns the named teams, or all the teams of org
+func importedTeams(ghc github.Client, org string, names []string) ([]github.Team, error) {
+	if len(names) == 0 {
+		return ghc.ListTeams(org)
+	}
+
+	var teams []github.Team
+	for _, name := range names {
+		t, err := ghc.GetTeamBySlug(strings.TrimPrefix(name, org+"/"), org)
+		if err != nil {
+			return nil, fmt.Errorf("team %v: %v", name, err)
+		}
+		teams = append(teams, *t)
+	}
+	return teams, nil
+}
+
+// renderAliases writes an OWNERS_ALIASES with sorted aliases and members
+func renderAliases(aliases map[string][]string) string {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("aliases:\n")
+	for _, name := range names {
+		if len(aliases[name]) == 0 {
+			fmt.Fprintf(&b, "  %v: []\n", name)
+			continue
+		}
+		fmt.Fprintf(&b, "  %v:\n", name)
+		members := append([]string(nil), aliases[name]...)
+		sort.Strings(members)
+		for _, m := range members {
+			fmt.Fprintf(&b, "    - %v\n", m)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"testing"
+)
+
+func TestRenderAliases(t *testing.T) {
+	tests := []struct {
+		name     string
+		aliases  map[string][]string
+		expected string
+	}{
+		{
+			name:     "no aliases",
+			expected: "aliases:\n",
+		},
+		{
+			name: "aliases and members are sorted",
+			aliases: map[string][]string{
+				"frontend": {"carol", "bob"},
+				"backend":  {"alice"},
+			},
+			expected: "aliases:\n" +
+				"  backend:\n" +
+				"    - alice\n" +
+				"  frontend:\n" +
+				"    - bob\n" +
+				"    - carol\n",
+		},
+		{
+			name:     "teams without members are empty lists",
+			aliases:  map[string][]string{"backend": {}},
+			expected: "aliases:\n  backend: []\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if rendered := renderAliases(tc.aliases); rendered != tc.expected {
+				t.Errorf("expected:\n%v\ngot:\n%v", tc.expected, rendered)
+			}
+		})
+	}
+}
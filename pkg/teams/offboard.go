@@ -0,0 +1,267 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var (
+	offboardRe           = regexp.MustCompile(`(?mi)^/offboard[ \t]+@?(\S+)[ \t]*$`)
+	offboardDisabledMsg  = "`/offboard` is disabled, set `offboard.alias` and `offboard.aliasRepo` on the teams plugin config to enable it"
+	offboardNotAllowed   = "Sorry @%v, only members of the `%v` alias of %v can offboard users"
+	offboardNothingMsg   = "@%v is not on any team or managed alias"
+	offboardMsg          = "Offboarding @%v:\n%v"
+	offboardTitle        = "Offboard %v"
+	offboardBody         = "Removes `%v` from `%v`, requested on %v/%v#%v."
+	offboardBranch       = "prow-plugins/offboard-%v"
+	offboardTeamLine     = "- team `%v`: %v"
+	offboardAliasLine    = "- `%v` on %v: %v"
+	offboardRemoved      = "removed"
+	offboardOpened       = "opened %v#%v"
+	offboardFailed       = "failed, `%v`"
+	offboardMemberLineRe = `(?i)^\s*-\s*["']?%v["']?\s*(#.*)?$`
+)
+
+// membership is a team of an org the offboarded user belongs to
+type membership struct {
+	org  string
+	team github.Team
+}
+
+// handleOffboard removes login from every team of the managed orgs and opens
+// pull requests removing it from the managed OWNERS_ALIASES
+func (s *Server) handleOffboard(l *logrus.Entry, org, repo, user string, number int, login string) error {
+	login = github.NormLogin(login)
+	l = l.WithFields(logrus.Fields{"user": user, "offboard": login})
+
+	if s.Config.Offboard.Alias == "" {
+		return s.Ghc.CreateComment(org, repo, number, offboardDisabledMsg)
+	}
+
+	// The alias is only read from the configured repo, the commented one may
+	// be any repo its authors can merge to
+	aliasRepo := strings.Split(s.Config.Offboard.AliasRepo, "/")
+	r, err := s.Ghc.GetRepo(aliasRepo[0], aliasRepo[1])
+	if err != nil {
+		l.WithError(err).Error("failed to get repo")
+		return err
+	}
+	aliases, err := s.Oc.LoadRepoAliases(aliasRepo[0], aliasRepo[1], r.DefaultBranch)
+	if err != nil {
+		l.WithError(err).Error("failed to load OWNERS_ALIASES")
+		return err
+	}
+	if !aliases.ExpandAlias(s.Config.Offboard.Alias).Has(github.NormLogin(user)) {
+		l.Warn("unauthorized /offboard")
+		msg := fmt.Sprintf(offboardNotAllowed, user, s.Config.Offboard.Alias, s.Config.Offboard.AliasRepo)
+		return s.Ghc.CreateComment(org, repo, number, msg)
+	}
+	l.Info("audit: /offboard invoked")
+
+	memberships, err := s.teamsOf(org, login)
+	if err != nil {
+		l.WithError(err).Error("failed to list teams")
+		return err
+	}
+
+	entries, err := s.aliasesOf(login)
+	if err != nil {
+		l.WithError(err).Error("failed to list aliases")
+		return err
+	}
+
+	if len(memberships) == 0 && len(entries) == 0 {
+		return s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(offboardNothingMsg, login))
+	}
+
+	var lines []string
+	for _, m := range memberships {
+		result := offboardRemoved
+		if err := s.Ghc.RemoveTeamMembership(m.team.ID, login); err != nil {
+			l.WithError(err).Errorf("failed to remove from %v/%v", m.org, m.team.Slug)
+			result = fmt.Sprintf(offboardFailed, err)
+		}
+		lines = append(lines, fmt.Sprintf(offboardTeamLine, m.org+"/"+m.team.Slug, result))
+	}
+
+	for _, fullName := range s.Config.Offboard.Repos {
+		if len(entries[fullName]) == 0 {
+			continue
+		}
+		parts := strings.Split(fullName, "/")
+		pr, err := s.offboardAliases(l, parts[0], parts[1], login, fmt.Sprintf(offboardBody, login, ownersAliasesName, org, repo, number))
+		result := fmt.Sprintf(offboardOpened, fullName, pr)
+		if err != nil {
+			l.WithError(err).Errorf("failed to open pull request on %v", fullName)
+			result = fmt.Sprintf(offboardFailed, err)
+		}
+		lines = append(lines, fmt.Sprintf(offboardAliasLine, strings.Join(entries[fullName], "`, `"), fullName, result))
+	}
+
+	return s.Ghc.CreateComment(org, repo, number, fmt.Sprintf(offboardMsg, login, strings.Join(lines, "\n")))
+}
+
+// teamsOf returns the teams login is on, across the org of the command and
+// the orgs of the offboard repos
+func (s *Server) teamsOf(org, login string) ([]membership, error) {
+	orgs := []string{strings.ToLower(org)}
+	for _, r := range s.Config.Offboard.Repos {
+		o := strings.ToLower(strings.Split(r, "/")[0])
+		if !sets.NewString(orgs...).Has(o) {
+			orgs = append(orgs, o)
+		}
+	}
+
+	var memberships []membership
+	for _, o := range orgs {
+		teams, err := s.Ghc.ListTeams(o)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			members, err := s.Ghc.ListTeamMembers(t.ID, github.RoleAll)
+			if err != nil {
+				return nil, err
+			}
+			if hasLogin(members, login) {
+				memberships = append(memberships, membership{org: o, team: t})
+			}
+		}
+	}
+	return memberships, nil
+}
+
+// aliasesOf returns the aliases with login, by offboard repo
+func (s *Server) aliasesOf(login string) (map[string][]string, error) {
+	entries := map[string][]string{}
+	for _, fullName := range s.Config.Offboard.Repos {
+		parts := strings.Split(fullName, "/")
+		r, err := s.Ghc.GetRepo(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		aliases, err := s.Oc.LoadRepoAliases(parts[0], parts[1], r.DefaultBranch)
+		if err != nil {
+			return nil, err
+		}
+		for alias, members := range aliases {
+			if members.Has(login) {
+				entries[fullName] = append(entries[fullName], alias)
+			}
+		}
+		sort.Strings(entries[fullName])
+	}
+	return entries, nil
+}
+
+// offboardAliases opens a pull request removing login from the OWNERS_ALIASES
+// of org/repo, lines are removed in place to keep the comments of the file
+func (s *Server) offboardAliases(l *logrus.Entry, org, repo, login, body string) (int, error) {
+	r, err := s.Ghc.GetRepo(org, repo)
+	if err != nil {
+		return 0, err
+	}
+
+	c, err := s.Gc.ClientFor(org, repo)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := c.Clean(); err != nil {
+			l.WithError(err).Error("failed to clean repo")
+		}
+	}()
+
+	if err = c.Checkout(r.DefaultBranch); err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(c.Directory(), ownersAliasesName)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err := removeAliasMember(content, login)
+	if err != nil {
+		return 0, err
+	}
+
+	branch := fmt.Sprintf(offboardBranch, login)
+	if err = c.CheckoutNewBranch(branch); err != nil {
+		return 0, err
+	}
+	if err = ioutil.WriteFile(path, updated, 0644); err != nil {
+		return 0, err
+	}
+
+	title := fmt.Sprintf(offboardTitle, login)
+	if err = c.Commit(title, body); err != nil {
+		return 0, err
+	}
+	if err = c.PushToCentral(branch, true); err != nil {
+		return 0, err
+	}
+	return s.Ghc.CreatePullRequest(org, repo, title, body, branch, r.DefaultBranch, true)
+}
+
+// removeAliasMember drops the list items of login, inline lists can't be
+// edited in place so the file is rendered again when login is still there
+func removeAliasMember(content []byte, login string) ([]byte, error) {
+	re := regexp.MustCompile(fmt.Sprintf(offboardMemberLineRe, regexp.QuoteMeta(login)))
+
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if !re.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	updated := []byte(strings.Join(lines, "\n"))
+
+	a := struct {
+		Aliases map[string][]string `yaml:"aliases"`
+	}{}
+	if err := yaml.Unmarshal(updated, &a); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", ownersAliasesName, err)
+	}
+
+	still := false
+	for alias, members := range a.Aliases {
+		kept := members[:0]
+		for _, m := range members {
+			if github.NormLogin(m) == login {
+				still = true
+				continue
+			}
+			kept = append(kept, m)
+		}
+		a.Aliases[alias] = kept
+	}
+	if still {
+		return []byte(renderAliases(a.Aliases)), nil
+	}
+	return updated, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package teams
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleOffboard(t *testing.T) {
+	gc, oc, cleanup := newOwnersClient(t, map[string]map[string][]byte{
+		"teams": {"OWNERS_ALIASES": []byte("aliases:\n  org-admins:\n    - admin\n")},
+		"app":   {"OWNERS_ALIASES": []byte("aliases:\n  org-admins:\n    - mallory\n")},
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		user     string
+		offboard Offboard
+		comments []string
+	}{
+		{
+			name:     "disabled without an alias",
+			user:     "admin",
+			comments: []string{offboardDisabledMsg},
+		},
+		{
+			name:     "alias member offboards",
+			user:     "Admin",
+			offboard: Offboard{Alias: "org-admins", AliasRepo: "org/teams"},
+			comments: []string{fmt.Sprintf(offboardNothingMsg, "octocat")},
+		},
+		{
+			name:     "commenter not in the alias is refused",
+			user:     "bob",
+			offboard: Offboard{Alias: "org-admins", AliasRepo: "org/teams"},
+			comments: []string{fmt.Sprintf(offboardNotAllowed, "bob", "org-admins", "org/teams")},
+		},
+		{
+			name:     "alias defined only on the commented repo is refused",
+			user:     "mallory",
+			offboard: Offboard{Alias: "org-admins", AliasRepo: "org/teams"},
+			comments: []string{fmt.Sprintf(offboardNotAllowed, "mallory", "org-admins", "org/teams")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ghc := &fakeGithub{}
+			s := &Server{Gc: gc, Oc: oc, Ghc: ghc, Config: &Config{Offboard: tc.offboard}}
+			l := logrus.NewEntry(logrus.New())
+
+			if err := s.handleOffboard(l, "org", "app", tc.user, 1, "@octocat"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ghc.comments, tc.comments) {
+				t.Errorf("expected comments %q, got %q", tc.comments, ghc.comments)
+			}
+		})
+	}
+}
+
+func TestRemoveAliasMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		login    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "list items are dropped keeping the rest of the file",
+			content:  "# Managed aliases\naliases:\n  backend:\n    - alice\n    - octocat # leaving\n  frontend:\n    - \"OctoCat\"\n    - bob\n",
+			login:    "octocat",
+			expected: "# Managed aliases\naliases:\n  backend:\n    - alice\n  frontend:\n    - bob\n",
+		},
+		{
+			name:     "logins sharing a prefix are kept",
+			content:  "aliases:\n  backend:\n    - octocat\n    - octocat2\n",
+			login:    "octocat",
+			expected: "aliases:\n  backend:\n    - octocat2\n",
+		},
+		{
+			name:     "inline lists are rendered again",
+			content:  "# Managed aliases\naliases:\n  backend: [alice, octocat]\n  frontend:\n    - bob\n",
+			login:    "octocat",
+			expected: "aliases:\n  backend:\n    - alice\n  frontend:\n    - bob\n",
+		},
+		{
+			name:     "the last member leaves an empty alias",
+			content:  "aliases:\n  backend: [octocat]\n",
+			login:    "octocat",
+			expected: "aliases:\n  backend: []\n",
+		},
+		{
+			name:     "missing login leaves the file as is",
+			content:  "aliases:\n  backend:\n    - alice\n",
+			login:    "octocat",
+			expected: "aliases:\n  backend:\n    - alice\n",
+		},
+		{
+			name:    "invalid file",
+			content: "aliases: [\n",
+			login:   "octocat",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := removeAliasMember([]byte(tc.content), tc.login)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && string(content) != tc.expected {
+				t.Errorf("expected:\n%v\ngot:\n%s", tc.expected, content)
+			}
+		})
+	}
+}
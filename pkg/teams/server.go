@@ -14,94 +14,91 @@ limitations under the License.
 package teams
 
 import (
-	"encoding/json"
-	"fmt"
+	"flag"
 	"net/http"
 
-	"github.com/sirupsen/logrus"
-
-	"k8s.io/test-infra/prow/github"
+	"github.com/dafiti-group/prow-plugins/pkg/plugin"
+	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/pluginhelp"
 )
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	//
-	eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, s.TokenGenerator)
-	if !ok {
-		s.Log.Error("validate webhook failed")
-		return
-	}
-
-	// Respond with
-	if err := s.serverHandler(eventType, eventGUID, payload); err != nil {
-		s.Log.WithError(err).Error("Error parsing event.")
-		fmt.Fprint(w, "Something went wrong")
-		return
-	}
-
-	//
-	s.Log.Info("handle event ok")
-	fmt.Fprint(w, "Event received. Have a nice day.")
+func init() {
+	plugin.Register(&Server{})
 }
 
-func (s *Server) serverHandler(eventType, eventGUID string, payload []byte) (err error) {
-	//
-	l := s.Log.WithFields(
-		logrus.Fields{
-			"event-type":     eventType,
-			github.EventGUID: eventGUID,
-		},
-	)
-	l.Info("Event received")
-
-	switch eventType {
-	case "issue_comment":
-		var e github.IssueCommentEvent
+// Name is the name of the plugin on plugins.yaml
+func (s *Server) Name() string {
+	return "teams"
+}
 
-		if err := json.Unmarshal(payload, &e); err != nil {
-			return err
-		}
+// Path is the legacy endpoint of the plugin
+func (s *Server) Path() string {
+	return "/teams-sync"
+}
 
-		go func() {
-			if err := s.handleCommentEvent(l, &e); err != nil {
-				l.WithError(err).WithFields(l.Data).Info("issue comment failed.")
-			}
-		}()
-	case "pull_request_review":
-		var e github.ReviewEvent
+// AddFlags registers the config flag
+func (s *Server) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.configPath, "teams-config", "", "Path to the teams plugin config file.")
+}
 
-		if err := json.Unmarshal(payload, &e); err != nil {
-			return err
-		}
+// Init loads the config and takes the shared clients
+func (s *Server) Init(a plugin.Agent) (err error) {
+	if s.Config, err = LoadConfig(s.configPath); err != nil {
+		return err
+	}
+	s.Gc = a.Gc
+	s.Oc = a.Oc
+	s.Ghc = a.Ghc
+	s.Log = a.Log
+	return nil
+}
 
-		go func() {
-			if err := s.handleReviewEvent(l, &e); err != nil {
-				l.WithError(err).WithFields(l.Data).Info("pull request review  failed.")
-			}
-		}()
-	case "pull_request":
-		var p github.PullRequestEvent
+// Handlers are the typed event handlers of the plugin
+func (s *Server) Handlers() plugin.Handlers {
+	return plugin.Handlers{
+		IssueComment: s.handleCommentEvent,
+		PullRequest:  s.handlePR,
+	}
+}
 
-		if err := json.Unmarshal(payload, &p); err != nil {
-			return err
-		}
+// Help describes the plugin and lists its commands
+func (s *Server) Help() *pluginhelp.PluginHelp {
+	return &pluginhelp.PluginHelp{
+		Description: "The teams plugin syncs the TEAMS and OWNERS_ALIASES files with the GitHub teams",
+		Commands:    []pluginhelp.Command{HelpProvider(), ImportHelpProvider(), OffboardHelpProvider()},
+	}
+}
 
-		go func() {
-			if err := s.handlePR(l, &p); err != nil {
-				s.Log.WithError(err).WithFields(l.Data).Info("Pull request event failed.")
-			}
-		}()
-	default:
-		s.Log.Debugf("skipping event of type %q", eventType)
+// Start checks the teams drift periodically, when drift repos are set
+func (s *Server) Start(_ *http.ServeMux) {
+	if len(s.Config.Drift.Repos) != 0 {
+		interrupts.TickLiteral(s.CheckDrift, s.Config.Drift.Interval)
 	}
-	return nil
 }
 
 func HelpProvider() pluginhelp.Command {
 	return pluginhelp.Command{
 		Usage:       "/sync-teams",
 		Description: "Syncs TEAMS file declaration with github teams",
-		WhoCanUse:   "Anyone",
+		WhoCanUse:   "Approvers of the root OWNERS file, members of the configured admin team and org owners",
 		Examples:    []string{"/sync-teams"},
 	}
 }
+
+func ImportHelpProvider() pluginhelp.Command {
+	return pluginhelp.Command{
+		Usage:       "/import-teams [team...]",
+		Description: "Opens a pull request writing the members of the org GitHub teams, or of the given ones, to OWNERS_ALIASES",
+		WhoCanUse:   "Members of the org",
+		Examples:    []string{"/import-teams", "/import-teams backend frontend"},
+	}
+}
+
+func OffboardHelpProvider() pluginhelp.Command {
+	return pluginhelp.Command{
+		Usage:       "/offboard <login>",
+		Description: "Removes the user from every GitHub team and opens pull requests removing them from the managed OWNERS_ALIASES",
+		WhoCanUse:   "Members of the configured offboard alias",
+		Examples:    []string{"/offboard octocat"},
+	}
+}
@@ -15,17 +15,17 @@ package teams
 
 import (
 	"github.com/sirupsen/logrus"
-	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/repoowners"
 )
 
 type Server struct {
-	TokenGenerator func() []byte
-	Gc             git.ClientFactory
-	ConfigAgent    *config.Agent
-	Oc             *repoowners.Client
-	Ghc            github.Client
-	Log            *logrus.Entry
+	Gc     git.ClientFactory
+	Oc     *repoowners.Client
+	Ghc    github.Client
+	Config *Config
+	Log    *logrus.Entry
+
+	configPath string
 }